@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// accountDeleted refuses a login to an account waiting to be purged.
+func accountDeleted(c *gin.Context, user models.User) {
+	response := gin.H{"error": "Account is scheduled for deletion"}
+	if user.PurgeAt != nil {
+		response["purge_at"] = user.PurgeAt
+	}
+	c.JSON(http.StatusForbidden, response)
+}
+
+// accountBlocked refuses a suspended or banned account. It reports whether
+// it did.
+func accountBlocked(c *gin.Context, user models.User) bool {
+	blocked := utils.CheckAccountStatus(user.Status, user.StatusReason, user.StatusUntil)
+	if blocked == nil {
+		return false
+	}
+	c.JSON(http.StatusForbidden, blocked.Response())
+	return true
+}
+
+// restoreAccount clears the deletion marks of an account that has not been
+// purged yet. It reports false when no deleted account matched.
+func restoreAccount(ctx context.Context, client *mongo.Client, userID string) (bool, error) {
+	var userCollection = database.OpenCollection(client, "users")
+
+	result, err := userCollection.UpdateOne(
+		ctx,
+		bson.M{"user_id": userID, "deleted_at": bson.M{"$exists": true}},
+		bson.M{
+			"$unset": bson.M{"deleted_at": "", "purge_at": ""},
+			"$set":   bson.M{"updated_at": time.Now()},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// @Summary Restore your deleted account
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Description Cancels a pending deletion during the grace period. Sign in again afterwards.
+// @Param body body models.RestoreAccountRequest true "Account credentials"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 429 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/restore-account [post]
+func RestoreAccount(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.RestoreAccountRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// Shares the login counters so this can't be used to guess passwords
+		emailKey := utils.EmailThrottleKey(req.Email)
+		ipKey := utils.IPThrottleKey(c.ClientIP())
+
+		wait, err := utils.LoginBlockedFor(ctx, client, emailKey, ipKey)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while checking login attempts"})
+			return
+		}
+		if wait > 0 {
+			tooManyAttempts(c, wait)
+			return
+		}
+
+		var userCollection = database.OpenCollection(client, "users")
+		var foundUser models.User
+
+		err = userCollection.FindOne(ctx, bson.M{"email": req.Email, "deleted_at": bson.M{"$exists": true}}, utils.FindUserByEmail()).Decode(&foundUser)
+		if err == nil && !checkPassword(ctx, client, foundUser, req.Password) {
+			err = errors.New("invalid password")
+		}
+		if err != nil {
+			if err := utils.RecordLoginFailure(ctx, client, emailKey, ipKey); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while recording login attempt"})
+				return
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+			return
+		}
+
+		if _, err := utils.ResetLoginFailures(ctx, client, emailKey); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while recording login attempt"})
+			return
+		}
+
+		restored, err := restoreAccount(ctx, client, foundUser.UserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while restoring account"})
+			return
+		}
+		if !restored {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+			return
+		}
+
+		c.Set("userId", foundUser.UserID)
+		c.Set("role", foundUser.Role)
+		utils.RecordAuditEvent(c, client, models.AuditEvent{
+			Action:     models.AuditActionUserRestore,
+			TargetType: "user",
+			TargetID:   foundUser.UserID,
+			Outcome:    models.AuditOutcomeSuccess,
+		})
+
+		c.JSON(http.StatusOK, gin.H{"message": "Account restored"})
+	}
+}
+
+// @Summary Restore a deleted user
+// @Tags users
+// @Produce json
+// @Security ApiKeyAuth
+// @Param userId path string true "User ID"
+// @Success 200 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 404 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/users/{userId}/restore [post]
+func RestoreUser(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Param("userId")
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		restored, err := restoreAccount(ctx, client, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while restoring account"})
+			return
+		}
+		if !restored {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No deleted user with this ID"})
+			return
+		}
+
+		utils.RecordAuditEvent(c, client, models.AuditEvent{
+			Action:     models.AuditActionUserRestore,
+			TargetType: "user",
+			TargetID:   userID,
+			Outcome:    models.AuditOutcomeSuccess,
+		})
+
+		c.JSON(http.StatusOK, gin.H{"message": "User restored"})
+	}
+}
+
+// @Summary Export your personal data
+// @Tags users
+// @Produce json
+// @Security ApiKeyAuth
+// @Description Downloads the profile, favourite genres, linked identities, sessions, API keys and audit events of the caller as a JSON file.
+// @Success 200 {object} models.UserDataExport
+// @Failure 401 {object} map[string]any
+// @Failure 404 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/me/export [get]
+func ExportUserData(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetuserIdFromCtx(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var userCollection = database.OpenCollection(client, "users")
+		var foundUser models.User
+
+		err = userCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&foundUser)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while fetching user"})
+			return
+		}
+
+		families, err := utils.ListUserSessions(ctx, userID, client)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while fetching sessions"})
+			return
+		}
+
+		apiKeys := []models.APIKey{}
+		keyCursor, err := database.OpenCollection(client, "api_keys").Find(
+			ctx,
+			bson.M{"user_id": userID},
+			options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+		)
+		if err == nil {
+			err = keyCursor.All(ctx, &apiKeys)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while fetching API keys"})
+			return
+		}
+
+		auditEvents := []models.AuditEvent{}
+		auditCursor, err := database.OpenCollection(client, "audit_events").Find(
+			ctx,
+			bson.M{"$or": bson.A{bson.M{"actor_id": userID}, bson.M{"target_id": userID}}},
+			options.Find().SetSort(bson.D{{Key: "time", Value: 1}}),
+		)
+		if err == nil {
+			err = auditCursor.All(ctx, &auditEvents)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while fetching audit events"})
+			return
+		}
+
+		identities := foundUser.OIDCIdentities
+		if identities == nil {
+			identities = []models.OIDCIdentity{}
+		}
+		genres, err := utils.ResolveGenres(ctx, client, foundUser.FavouriteGenreIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while fetching genres"})
+			return
+		}
+
+		export := models.UserDataExport{
+			ExportedAt:            time.Now(),
+			UserID:                foundUser.UserID,
+			FirstName:             foundUser.FirstName,
+			LastName:              foundUser.LastName,
+			Email:                 foundUser.Email,
+			Role:                  foundUser.Role,
+			CreatedAt:             foundUser.CreatedAt,
+			UpdatedAt:             foundUser.UpdatedAt,
+			PendingVerification:   foundUser.PendingVerification,
+			TOTPEnabled:           foundUser.TOTPEnabled,
+			FavouriteMoviesGenres: genres,
+			OIDCIdentities:        identities,
+			Sessions:              toSessions(families, c.GetString("familyId")),
+			APIKeys:               apiKeys,
+			AuditEvents:           auditEvents,
+		}
+
+		c.Header("Content-Disposition", `attachment; filename="movie-app-data-`+userID+`.json"`)
+		c.IndentedJSON(http.StatusOK, export)
+	}
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// @Summary Create an API key
+// @Tags api-keys
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Description The key is only returned in this response. Write scopes require an ADMIN account.
+// @Param body body models.CreateAPIKeyRequest true "Key name and scopes"
+// @Success 201 {object} models.CreateAPIKeyResponse
+// @Failure 400 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/api-keys [post]
+func CreateAPIKey(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetuserIdFromCtx(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+			return
+		}
+
+		role, err := utils.GetRoleFromCtx(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Role not found in context"})
+			return
+		}
+
+		var req models.CreateAPIKeyRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// A key can't do more than its owner could
+		for _, scope := range req.Scopes {
+			if scope != models.ScopeMoviesRead && role != models.RoleAdmin {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can create keys with the " + scope + " scope"})
+				return
+			}
+		}
+
+		key, keyHash, err := utils.NewAPIKey()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while generating API key"})
+			return
+		}
+
+		apiKey := models.APIKey{
+			KeyID:     bson.NewObjectID().Hex(),
+			UserID:    userID,
+			Name:      req.Name,
+			Prefix:    key[:len(utils.APIKeyPrefix)+6],
+			KeyHash:   keyHash,
+			Scopes:    req.Scopes,
+			TwoFactor: c.GetBool("twoFactor"),
+			CreatedAt: time.Now(),
+		}
+		if req.ExpiresInDays > 0 {
+			expiresAt := apiKey.CreatedAt.AddDate(0, 0, req.ExpiresInDays)
+			apiKey.ExpiresAt = &expiresAt
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var keyCollection = database.OpenCollection(client, "api_keys")
+
+		result, err := keyCollection.InsertOne(ctx, apiKey)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while creating API key"})
+			return
+		}
+		apiKey.ID, _ = result.InsertedID.(bson.ObjectID)
+
+		c.JSON(http.StatusCreated, models.CreateAPIKeyResponse{Key: key, APIKey: apiKey})
+	}
+}
+
+// @Summary List your API keys
+// @Tags api-keys
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} models.APIKey
+// @Failure 401 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/api-keys [get]
+func GetAPIKeys(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetuserIdFromCtx(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var keyCollection = database.OpenCollection(client, "api_keys")
+
+		cursor, err := keyCollection.Find(
+			ctx,
+			bson.M{"user_id": userID},
+			options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while fetching API keys"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		apiKeys := []models.APIKey{}
+		if err := cursor.All(ctx, &apiKeys); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while decoding API keys"})
+			return
+		}
+
+		c.JSON(http.StatusOK, apiKeys)
+	}
+}
+
+// @Summary Revoke an API key
+// @Tags api-keys
+// @Produce json
+// @Security ApiKeyAuth
+// @Param keyId path string true "API key ID"
+// @Success 200 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 404 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/api-keys/{keyId} [delete]
+func DeleteAPIKey(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetuserIdFromCtx(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var keyCollection = database.OpenCollection(client, "api_keys")
+
+		result, err := keyCollection.DeleteOne(ctx, bson.M{"key_id": c.Param("keyId"), "user_id": userID})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while revoking API key"})
+			return
+		}
+		if result.DeletedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+	}
+}
@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+// auditLogin records a login attempt. The user is both actor and target;
+// userID is empty when the email matched no account.
+func auditLogin(c *gin.Context, client *mongo.Client, userID, role, email, method, outcome, reason string) {
+	details := map[string]any{"method": method}
+	if email != "" {
+		details["email"] = email
+	}
+	if reason != "" {
+		details["reason"] = reason
+	}
+
+	utils.RecordAuditEvent(c, client, models.AuditEvent{
+		ActorID:    userID,
+		ActorRole:  role,
+		Action:     models.AuditActionLogin,
+		TargetType: "user",
+		TargetID:   userID,
+		Outcome:    outcome,
+		Details:    details,
+	})
+}
+
+// auditFilter builds the query shared by the listing and the export from the
+// action, outcome, actor_id, target_id, from and to query parameters.
+func auditFilter(c *gin.Context) (bson.M, error) {
+	filter := bson.M{}
+
+	for _, field := range []string{"action", "outcome", "actor_id", "target_id"} {
+		if value := c.Query(field); value != "" {
+			filter[field] = value
+		}
+	}
+
+	timeRange := bson.M{}
+	if from := c.Query("from"); from != "" {
+		parsed, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return nil, err
+		}
+		timeRange["$gte"] = parsed
+	}
+	if to := c.Query("to"); to != "" {
+		parsed, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return nil, err
+		}
+		timeRange["$lt"] = parsed
+	}
+	if len(timeRange) > 0 {
+		filter["time"] = timeRange
+	}
+
+	return filter, nil
+}
+
+// @Summary Query the audit log
+// @Tags audit
+// @Produce json
+// @Security ApiKeyAuth
+// @Param action query string false "Action, e.g. auth.login"
+// @Param outcome query string false "success or failure"
+// @Param actor_id query string false "User who acted"
+// @Param target_id query string false "Affected user or movie"
+// @Param from query string false "Earliest time (RFC 3339)"
+// @Param to query string false "Latest time, exclusive (RFC 3339)"
+// @Param page query int false "Page number, starting at 1"
+// @Param limit query int false "Page size, at most 500"
+// @Success 200 {object} models.AuditEventPage
+// @Failure 400 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/audit-events [get]
+func GetAuditEvents(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := auditFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from and to must be RFC 3339 times"})
+			return
+		}
+
+		page, err := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+		if err != nil || page < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "page must be a positive number"})
+			return
+		}
+
+		limit, err := strconv.ParseInt(c.DefaultQuery("limit", strconv.Itoa(defaultAuditPageSize)), 10, 64)
+		if err != nil || limit < 1 || limit > maxAuditPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var auditCollection = database.OpenCollection(client, "audit_events")
+
+		total, err := auditCollection.CountDocuments(ctx, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while counting audit events"})
+			return
+		}
+
+		cursor, err := auditCollection.Find(
+			ctx,
+			filter,
+			options.Find().
+				SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}).
+				SetSkip((page-1)*limit).
+				SetLimit(limit),
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while fetching audit events"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		events := []models.AuditEvent{}
+		if err := cursor.All(ctx, &events); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while decoding audit events"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.AuditEventPage{Data: events, Page: page, Limit: limit, Total: total})
+	}
+}
+
+// @Summary Export the audit log as NDJSON
+// @Tags audit
+// @Produce application/x-ndjson
+// @Security ApiKeyAuth
+// @Description Streams every matching event, oldest first, one JSON object per line.
+// @Param action query string false "Action, e.g. auth.login"
+// @Param outcome query string false "success or failure"
+// @Param actor_id query string false "User who acted"
+// @Param target_id query string false "Affected user or movie"
+// @Param from query string false "Earliest time (RFC 3339)"
+// @Param to query string false "Latest time, exclusive (RFC 3339)"
+// @Success 200 {string} string
+// @Failure 400 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/audit-events/export [get]
+func ExportAuditEvents(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := auditFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from and to must be RFC 3339 times"})
+			return
+		}
+
+		// Bound to the request so a dropped download stops the query
+		ctx := c.Request.Context()
+
+		var auditCollection = database.OpenCollection(client, "audit_events")
+
+		cursor, err := auditCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "time", Value: 1}, {Key: "_id", Value: 1}}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while fetching audit events"})
+			return
+		}
+		defer cursor.Close(ctx)
+
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Content-Disposition", `attachment; filename="audit-events.ndjson"`)
+		c.Status(http.StatusOK)
+
+		encoder := json.NewEncoder(c.Writer)
+		for cursor.Next(ctx) {
+			var event models.AuditEvent
+			if err := cursor.Decode(&event); err != nil {
+				c.Error(err)
+				return
+			}
+			if err := encoder.Encode(event); err != nil {
+				c.Error(err)
+				return
+			}
+			c.Writer.Flush()
+		}
+
+		// Headers are gone by now; a truncated file is all that can signal it
+		if err := cursor.Err(); err != nil {
+			c.Error(err)
+		}
+	}
+}
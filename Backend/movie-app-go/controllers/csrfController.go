@@ -0,0 +1,39 @@
+package controllers
+
+import (
+	"net/http"
+
+	"movie-app-go/models"
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary Get a CSRF token
+// @Tags auth
+// @Produce json
+// @Security ApiKeyAuth
+// @Description Send it back in the X-CSRF-Token header on POST, PUT, PATCH and DELETE requests authenticated with the access_token cookie. It is valid until the session ends.
+// @Success 200 {object} models.CSRFTokenResponse
+// @Failure 400 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/csrf-token [get]
+func GetCSRFToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		familyId := c.GetString("familyId")
+		if familyId == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "CSRF tokens are only issued to login sessions"})
+			return
+		}
+
+		token, err := utils.GenerateCSRFToken(familyId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while generating CSRF token"})
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, models.CSRFTokenResponse{CSRFToken: token})
+	}
+}
@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"movie-app-go/models"
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// @Summary Get an anonymous guest token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Description Guests can browse the catalog read-only. The token can't be refreshed; ask for a new one when it expires. Genres picked now are kept when the guest signs up. Each IP can only open a limited number of guest sessions per hour.
+// @Param body body models.GuestGenresRequest false "Favourite genres"
+// @Success 201 {object} models.GuestTokenResponse
+// @Failure 400 {object} map[string]any
+// @Failure 429 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/guest [post]
+func CreateGuestSession(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.GuestGenresRequest
+
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		// Each call stores a guest, so addresses can only open a few per hour
+		wait, err := utils.GuestSessionsBlockedFor(ctx, client, c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while checking guest sessions"})
+			return
+		}
+		if wait > 0 {
+			tooManyRequests(c, wait, "Too many guest sessions from this address, try again later")
+			return
+		}
+		if err := utils.RecordGuestSession(ctx, client, c.ClientIP()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while checking guest sessions"})
+			return
+		}
+
+		genres, err := utils.ValidateGenreIDs(ctx, client, req.FavouriteGenreIDs)
+		if err != nil {
+			genreError(c, err)
+			return
+		}
+
+		guest, err := utils.CreateGuest(ctx, client, genres)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while creating guest session"})
+			return
+		}
+
+		accessToken, err := utils.GenerateGuestToken(guest.GuestID, guest.ExpiresAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while generating tokens"})
+			return
+		}
+
+		csrfToken, err := utils.GenerateCSRFToken(guest.GuestID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while generating tokens"})
+			return
+		}
+
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     "access_token",
+			Value:    accessToken,
+			Path:     "/",
+			MaxAge:   int(utils.GuestTokenTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteNoneMode,
+		})
+
+		c.JSON(http.StatusCreated, models.GuestTokenResponse{
+			GuestID:               guest.GuestID,
+			Role:                  models.RoleGuest,
+			AccessToken:           accessToken,
+			CSRFToken:             csrfToken,
+			ExpiresAt:             guest.ExpiresAt,
+			FavouriteMoviesGenres: guest.FavouriteMoviesGenres,
+		})
+	}
+}
+
+// @Summary Pick favourite genres as a guest
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param body body models.GuestGenresRequest true "Favourite genres"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/guest/genres [put]
+func UpdateGuestGenres(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		guestID, err := utils.GetuserIdFromCtx(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+			return
+		}
+
+		var req models.GuestGenresRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		genres, err := utils.ValidateGenreIDs(ctx, client, req.FavouriteGenreIDs)
+		if err != nil {
+			genreError(c, err)
+			return
+		}
+
+		if err := utils.SetGuestGenres(ctx, client, guestID, genres); err != nil {
+			if errors.Is(err, utils.ErrGuestNotFound) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Guest session expired"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while updating genres"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Genres updated successfully"})
+	}
+}
+
+// guestFromRequest returns the claims of a still valid guest token sent with
+// the request, or nil.
+func guestFromRequest(c *gin.Context) *utils.SigninDetails {
+	token, err := utils.GetAcessToken(c)
+	if err != nil || token == "" || utils.IsAPIKey(token) {
+		return nil
+	}
+
+	claims, err := utils.ValidateToken(token)
+	if err != nil || claims.Role != models.RoleGuest || claims.ID == "" {
+		return nil
+	}
+
+	revoked, err := utils.Revocations.IsRevoked(c.Request.Context(), claims)
+	if err != nil || revoked {
+		return nil
+	}
+
+	return claims
+}
+
+// mergeGenreIDs keeps the genres picked at signup and adds the ones picked as
+// a guest that are missing.
+func mergeGenreIDs(picked, fromGuest []string) []string {
+	seen := map[string]bool{}
+	merged := []string{}
+
+	for _, ids := range [][]string{picked, fromGuest} {
+		for _, id := range ids {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			merged = append(merged, id)
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// @Summary Clear a login lockout
+// @Tags users
+// @Produce json
+// @Security ApiKeyAuth
+// @Description Lifts the login throttle of an email or IP, the second-step throttle of a user with two-factor login, or the guest session limit of an IP.
+// @Param email query string false "Email address to unlock"
+// @Param ip query string false "Client IP to unlock"
+// @Param user_id query string false "User whose two-factor attempts to unlock"
+// @Param guest_ip query string false "Client IP whose guest session limit to reset"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/lockout [delete]
+func ClearLockout(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var keys []utils.ThrottleKey
+
+		if email := c.Query("email"); email != "" {
+			keys = append(keys, utils.EmailThrottleKey(email))
+		}
+		if ip := c.Query("ip"); ip != "" {
+			keys = append(keys, utils.IPThrottleKey(ip))
+		}
+		if userId := c.Query("user_id"); userId != "" {
+			keys = append(keys, utils.TwoFactorThrottleKey(userId))
+		}
+		guestIP := c.Query("guest_ip")
+
+		if len(keys) == 0 && guestIP == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "email, ip, user_id or guest_ip is required"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var cleared int64
+
+		if len(keys) > 0 {
+			count, err := utils.ResetLoginFailures(ctx, client, keys...)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while clearing lockout"})
+				return
+			}
+			cleared += count
+		}
+
+		if guestIP != "" {
+			count, err := utils.ResetGuestSessions(ctx, client, guestIP)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while clearing lockout"})
+				return
+			}
+			cleared += count
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Lockout cleared", "cleared": cleared})
+	}
+}
@@ -6,7 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -30,10 +33,15 @@ var validate = validator.New()
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
+// @Description An imdb_id that is already in the catalog answers 409 with the location of the existing movie, unless upsert=true is set; the movie is then replaced like with PUT /movie/{imdbId}.
 // @Param body body models.Movie true "Movie"
+// @Param upsert query bool false "Replace the movie when the imdb_id already exists"
+// @Success 200 {object} map[string]any
 // @Success 201 {object} map[string]any
 // @Failure 400 {object} map[string]any
 // @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 409 {object} map[string]any
 // @Failure 500 {object} map[string]any
 // @Router /addmovie [post]
 func AddMovie(client *mongo.Client) gin.HandlerFunc {
@@ -41,6 +49,12 @@ func AddMovie(client *mongo.Client) gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
+		upsert, err := strconv.ParseBool(c.DefaultQuery("upsert", "false"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "upsert must be true or false"})
+			return
+		}
+
 		var movie models.Movie
 
 		if err := c.ShouldBindJSON(&movie); err != nil {
@@ -54,16 +68,358 @@ func AddMovie(client *mongo.Client) gin.HandlerFunc {
 		}
 
 		var movieCollection = database.OpenCollection(client, "movies")
+
+		if upsert {
+			result, err := movieCollection.UpdateOne(ctx, bson.M{"imdb_id": movie.ImdbID}, movieUpsert(movie), options.UpdateOne().SetUpsert(true))
+			if mongo.IsDuplicateKeyError(err) {
+				// A concurrent upsert inserted the movie first; this time the
+				// filter matches it and the write becomes an update
+				result, err = movieCollection.UpdateOne(ctx, bson.M{"imdb_id": movie.ImdbID}, movieUpsert(movie), options.UpdateOne().SetUpsert(true))
+			}
+			if err != nil {
+				if mongo.IsDuplicateKeyError(err) {
+					movieExists(c, movie.ImdbID)
+					return
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while saving movie"})
+				return
+			}
+
+			if result.UpsertedCount == 0 {
+				utils.RecordAuditEvent(c, client, models.AuditEvent{
+					Action:     models.AuditActionMovieUpdate,
+					TargetType: "movie",
+					TargetID:   movie.ImdbID,
+					Outcome:    models.AuditOutcomeSuccess,
+					Details:    map[string]any{"mode": "upsert", "title": movie.Title},
+				})
+
+				c.JSON(http.StatusOK, gin.H{"data": result, "updated": true})
+				return
+			}
+
+			utils.RecordAuditEvent(c, client, models.AuditEvent{
+				Action:     models.AuditActionMovieCreate,
+				TargetType: "movie",
+				TargetID:   movie.ImdbID,
+				Outcome:    models.AuditOutcomeSuccess,
+				Details:    map[string]any{"title": movie.Title},
+			})
+
+			c.Header("Location", moviePath(movie.ImdbID))
+			c.JSON(http.StatusCreated, gin.H{"data": result})
+			return
+		}
+
 		data, err := movieCollection.InsertOne(ctx, movie)
 		if err != nil {
+			if mongo.IsDuplicateKeyError(err) {
+				movieExists(c, movie.ImdbID)
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while inserting movie"})
 			return
 		}
 
+		utils.RecordAuditEvent(c, client, models.AuditEvent{
+			Action:     models.AuditActionMovieCreate,
+			TargetType: "movie",
+			TargetID:   movie.ImdbID,
+			Outcome:    models.AuditOutcomeSuccess,
+			Details:    map[string]any{"title": movie.Title},
+		})
+
+		c.Header("Location", moviePath(movie.ImdbID))
 		c.JSON(http.StatusCreated, gin.H{"data": data})
 	}
 }
 
+func moviePath(imdbID string) string {
+	return "/api/v1/movie/" + url.PathEscape(imdbID)
+}
+
+// movieExists answers an insert that clashes with a movie already in the
+// catalog, pointing at it.
+func movieExists(c *gin.Context, imdbID string) {
+	c.Header("Location", moviePath(imdbID))
+	c.JSON(http.StatusConflict, gin.H{
+		"error":    "A movie with this imdb_id already exists",
+		"imdb_id":  imdbID,
+		"location": moviePath(imdbID),
+	})
+}
+
+// movieUpsert writes every catalog field of movie. The admin review and
+// ranking are only taken from movie when it is new; an existing movie keeps
+// its own.
+func movieUpsert(movie models.Movie) bson.M {
+	return bson.M{
+		"$set": bson.M{
+			"title":        movie.Title,
+			"poster_url":   movie.PosterURL,
+			"youtube_id":   movie.YoutubeID,
+			"genres":       movie.Genres,
+			"release_year": movie.ReleaseYear,
+			"description":  movie.Description,
+		},
+		"$setOnInsert": bson.M{
+			"admin_review": movie.AdminReview,
+			"ranking":      movie.Ranking,
+		},
+	}
+}
+
+// @Summary Replace a movie
+// @Tags movies
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Description Replaces every catalog field. The admin review and ranking are kept and don't need to be sent; change them with /movie/review/{imdbId}.
+// @Param imdbId path string true "IMDb ID"
+// @Param body body models.Movie true "Movie"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 404 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /movie/{imdbId} [put]
+func ReplaceMovie(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		movieID := c.Param("imdbId")
+
+		var movie models.Movie
+
+		if err := c.ShouldBindJSON(&movie); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if movie.ImdbID == "" {
+			movie.ImdbID = movieID
+		}
+		if movie.ImdbID != movieID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "imdb_id does not match the movie in the URL"})
+			return
+		}
+
+		// Ranking and review are carried over from the stored movie, so a replace
+		// doesn't have to send them
+		if err := validate.StructExcept(movie, "Ranking"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var movieCollection = database.OpenCollection(client, "movies")
+
+		var existing models.Movie
+		err := movieCollection.FindOne(ctx, bson.M{"imdb_id": movieID}).Decode(&existing)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Movie not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while fetching movie"})
+			return
+		}
+
+		movie.ID = existing.ID
+		movie.AdminReview = existing.AdminReview
+		movie.Ranking = existing.Ranking
+
+		result, err := movieCollection.ReplaceOne(ctx, bson.M{"_id": existing.ID}, movie)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while updating movie"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Movie not found"})
+			return
+		}
+
+		utils.RecordAuditEvent(c, client, models.AuditEvent{
+			Action:     models.AuditActionMovieUpdate,
+			TargetType: "movie",
+			TargetID:   movieID,
+			Outcome:    models.AuditOutcomeSuccess,
+			Details:    map[string]any{"mode": "replace", "title": movie.Title},
+		})
+
+		c.JSON(http.StatusOK, gin.H{"data": movie})
+	}
+}
+
+// @Summary Update some fields of a movie
+// @Tags movies
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Description Only the fields sent are changed, each validated like in /addmovie.
+// @Param imdbId path string true "IMDb ID"
+// @Param body body models.MoviePatch true "Fields to change"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 404 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /movie/{imdbId} [patch]
+func PatchMovie(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		movieID := c.Param("imdbId")
+
+		var patch models.MoviePatch
+
+		if err := c.ShouldBindJSON(&patch); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if patch.ImdbID != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "imdb_id can't be changed"})
+			return
+		}
+		if patch.AdminReview != nil || patch.Ranking != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Use /movie/review/{imdbId} to change the admin review"})
+			return
+		}
+
+		// The patched fields are copied onto a Movie so each is checked
+		// against the tags of the full model
+		var movie models.Movie
+		set := bson.M{}
+		fields := []string{}
+
+		if patch.Title != nil {
+			movie.Title = *patch.Title
+			set["title"] = movie.Title
+			fields = append(fields, "Title")
+		}
+		if patch.PosterURL != nil {
+			movie.PosterURL = *patch.PosterURL
+			set["poster_url"] = movie.PosterURL
+			fields = append(fields, "PosterURL")
+		}
+		if patch.YoutubeID != nil {
+			movie.YoutubeID = *patch.YoutubeID
+			set["youtube_id"] = movie.YoutubeID
+			fields = append(fields, "YoutubeID")
+		}
+		if patch.Genres != nil {
+			movie.Genres = *patch.Genres
+			set["genres"] = movie.Genres
+			fields = append(fields, "Genres")
+			// Partial validation doesn't dive on its own
+			for i := range movie.Genres {
+				fields = append(fields, fmt.Sprintf("Genres[%d].GenreID", i), fmt.Sprintf("Genres[%d].GenreName", i))
+			}
+		}
+		if patch.ReleaseYear != nil {
+			movie.ReleaseYear = *patch.ReleaseYear
+			set["release_year"] = movie.ReleaseYear
+			fields = append(fields, "ReleaseYear")
+		}
+		if patch.Description != nil {
+			movie.Description = *patch.Description
+			set["description"] = movie.Description
+			fields = append(fields, "Description")
+		}
+
+		if len(fields) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No fields to update"})
+			return
+		}
+
+		if err := validate.StructPartial(movie, fields...); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var movieCollection = database.OpenCollection(client, "movies")
+
+		var updated models.Movie
+		err := movieCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"imdb_id": movieID},
+			bson.M{"$set": set},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&updated)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Movie not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while updating movie"})
+			return
+		}
+
+		changed := make([]string, 0, len(set))
+		for field := range set {
+			changed = append(changed, field)
+		}
+		sort.Strings(changed)
+
+		utils.RecordAuditEvent(c, client, models.AuditEvent{
+			Action:     models.AuditActionMovieUpdate,
+			TargetType: "movie",
+			TargetID:   movieID,
+			Outcome:    models.AuditOutcomeSuccess,
+			Details:    map[string]any{"mode": "patch", "fields": changed},
+		})
+
+		c.JSON(http.StatusOK, gin.H{"data": updated})
+	}
+}
+
+// @Summary Delete a movie
+// @Tags movies
+// @Produce json
+// @Security ApiKeyAuth
+// @Param imdbId path string true "IMDb ID"
+// @Success 200 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 404 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /movie/{imdbId} [delete]
+func DeleteMovie(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		movieID := c.Param("imdbId")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var movieCollection = database.OpenCollection(client, "movies")
+
+		var deleted models.Movie
+		err := movieCollection.FindOneAndDelete(ctx, bson.M{"imdb_id": movieID}).Decode(&deleted)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Movie not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while deleting movie"})
+			return
+		}
+
+		utils.RecordAuditEvent(c, client, models.AuditEvent{
+			Action:     models.AuditActionMovieDelete,
+			TargetType: "movie",
+			TargetID:   movieID,
+			Outcome:    models.AuditOutcomeSuccess,
+			Details:    map[string]any{"title": deleted.Title},
+		})
+
+		c.JSON(http.StatusOK, gin.H{"message": "Movie deleted successfully"})
+	}
+}
+
 // @Summary List movies
 // @Tags movies
 // @Produce json
@@ -231,12 +587,12 @@ func GetUsersFavouriteGenres(client *mongo.Client, userID string) ([]string, err
 
 	filter := bson.M{"user_id": userID}
 
-	projection := bson.M{"favourite_movies_genres": 1, "_id": 0}
+	projection := bson.M{"favourite_genre_ids": 1, "_id": 0}
 
 	options := options.FindOne().SetProjection(projection)
 
 	var result struct {
-		FavouriteMoviesGenres []models.Genre `bson:"favourite_movies_genres"`
+		FavouriteGenreIDs []string `bson:"favourite_genre_ids"`
 	}
 
 	var userCollection = database.OpenCollection(client, "users")
@@ -249,8 +605,13 @@ func GetUsersFavouriteGenres(client *mongo.Client, userID string) ([]string, err
 		return nil, err
 	}
 
+	genres, err := utils.ResolveGenres(ctx, client, result.FavouriteGenreIDs)
+	if err != nil {
+		return nil, err
+	}
+
 	var favGenres []string
-	for _, genre := range result.FavouriteMoviesGenres {
+	for _, genre := range genres {
 		favGenres = append(favGenres, genre.GenreName)
 	}
 
@@ -337,17 +698,12 @@ func GetReviewRanking(admin_review string, client *mongo.Client, c *gin.Context)
 // @Success 200 {object} map[string]any
 // @Failure 400 {object} map[string]any
 // @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
 // @Failure 404 {object} map[string]any
 // @Failure 500 {object} map[string]any
 // @Router /movie/review/{imdbId} [patch]
 func UpdateAdminReview(client *mongo.Client) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, err := utils.GetRoleFromCtx(c)
-		if err != nil || role != "ADMIN" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
-			return
-		}
-
 		movieId := c.Param("imdbId")
 		if movieId == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Movie ID is required"})
@@ -393,6 +749,14 @@ func UpdateAdminReview(client *mongo.Client) gin.HandlerFunc {
 			return
 		}
 
+		utils.RecordAuditEvent(c, client, models.AuditEvent{
+			Action:     models.AuditActionReviewUpdate,
+			TargetType: "movie",
+			TargetID:   movieId,
+			Outcome:    models.AuditOutcomeSuccess,
+			Details:    map[string]any{"ranking_name": sentiment},
+		})
+
 		res.RankingName = sentiment
 		res.AdminReview = req.AdminReview
 
@@ -0,0 +1,263 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	movieImportBatchSize = 500
+	maxMovieImportBytes  = 64 << 20
+)
+
+// pendingMovie is a valid row waiting for its batch to be written. Row is the
+// index of its entry in the report.
+type pendingMovie struct {
+	row   int
+	movie models.Movie
+}
+
+// @Summary Import movies in bulk
+// @Tags movies
+// @Accept json
+// @Accept application/x-ndjson
+// @Accept text/csv
+// @Produce json
+// @Security ApiKeyAuth
+// @Description Reads a JSON array of movies (the seed/movies.json shape), NDJSON or CSV, picked with format or the Content-Type. CSV needs a header naming columns from imdb_id, title, poster_url, youtube_id, genres (id:name pairs separated by |), release_year, description, admin_review, ranking_value and ranking_name. Every row is validated like /addmovie and valid rows are written in batches; the report gives the outcome of each row. dry_run only validates and checks for existing imdb_ids, upsert updates existing movies like /addmovie?upsert=true.
+// @Param format query string false "json, ndjson or csv"
+// @Param dry_run query bool false "Validate without writing"
+// @Param upsert query bool false "Update movies whose imdb_id already exists"
+// @Success 200 {object} models.MovieImportReport
+// @Failure 400 {object} models.MovieImportReport
+// @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Router /movies/import [post]
+func ImportMovies(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format, err := utils.ImportFormat(c.Query("format"), c.ContentType())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "dry_run must be true or false"})
+			return
+		}
+
+		upsert, err := strconv.ParseBool(c.DefaultQuery("upsert", "false"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "upsert must be true or false"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+
+		var movieCollection = database.OpenCollection(client, "movies")
+
+		report := models.MovieImportReport{Format: format, DryRun: dryRun, Upsert: upsert, Rows: []models.MovieImportRow{}}
+		seen := map[string]int{}
+		batch := []pendingMovie{}
+
+		flush := func() {
+			if len(batch) == 0 {
+				return
+			}
+			switch {
+			case dryRun:
+				checkMovieBatch(ctx, movieCollection, batch, upsert, &report)
+			case upsert:
+				upsertMovieBatch(ctx, movieCollection, batch, &report)
+			default:
+				insertMovieBatch(ctx, movieCollection, batch, &report)
+			}
+			batch = batch[:0]
+		}
+
+		body := http.MaxBytesReader(c.Writer, c.Request.Body, maxMovieImportBytes)
+
+		readErr := utils.ReadMovieRows(format, body, func(number int, movie models.Movie, err error) bool {
+			row := models.MovieImportRow{Row: number, ImdbID: movie.ImdbID}
+
+			if err == nil {
+				err = validate.Struct(movie)
+			}
+			if err == nil {
+				if first, ok := seen[movie.ImdbID]; ok {
+					err = fmt.Errorf("imdb_id already used by row %d", first)
+				}
+			}
+			if err != nil {
+				row.Status = models.ImportRowInvalid
+				row.Error = err.Error()
+				report.Rows = append(report.Rows, row)
+				return true
+			}
+
+			seen[movie.ImdbID] = number
+			report.Rows = append(report.Rows, row)
+			batch = append(batch, pendingMovie{row: len(report.Rows) - 1, movie: movie})
+
+			if len(batch) == movieImportBatchSize {
+				flush()
+			}
+			return ctx.Err() == nil
+		})
+		flush()
+
+		if readErr == nil {
+			readErr = ctx.Err()
+		}
+		if readErr != nil {
+			report.Error = readErr.Error()
+		}
+
+		report.Total = len(report.Rows)
+		for _, row := range report.Rows {
+			switch row.Status {
+			case models.ImportRowCreated:
+				report.Created++
+			case models.ImportRowUpdated:
+				report.Updated++
+			case models.ImportRowValid:
+				report.Valid++
+			default:
+				report.Failed++
+			}
+		}
+
+		if !dryRun && report.Created+report.Updated > 0 {
+			utils.RecordAuditEvent(c, client, models.AuditEvent{
+				Action:     models.AuditActionMovieImport,
+				TargetType: "movie",
+				Outcome:    models.AuditOutcomeSuccess,
+				Details: map[string]any{
+					"format":  format,
+					"total":   report.Total,
+					"created": report.Created,
+					"updated": report.Updated,
+					"failed":  report.Failed,
+				},
+			})
+		}
+
+		// Rows read before a broken stream have still been written
+		if readErr != nil {
+			c.JSON(http.StatusBadRequest, report)
+			return
+		}
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// checkMovieBatch reports the rows of a dry run, flagging movies that an
+// insert would clash with.
+func checkMovieBatch(ctx context.Context, movieCollection *mongo.Collection, batch []pendingMovie, upsert bool, report *models.MovieImportReport) {
+	ids := make([]string, 0, len(batch))
+	for _, pending := range batch {
+		ids = append(ids, pending.movie.ImdbID)
+	}
+
+	existing := map[string]bool{}
+	cursor, err := movieCollection.Find(ctx, bson.M{"imdb_id": bson.M{"$in": ids}}, options.Find().SetProjection(bson.M{"imdb_id": 1}))
+	if err == nil {
+		var found []models.Movie
+		err = cursor.All(ctx, &found)
+		for _, movie := range found {
+			existing[movie.ImdbID] = true
+		}
+	}
+
+	for _, pending := range batch {
+		row := &report.Rows[pending.row]
+		switch {
+		case err != nil:
+			row.Status = models.ImportRowFailed
+			row.Error = "Error while checking for existing movies"
+		case existing[pending.movie.ImdbID] && !upsert:
+			row.Status = models.ImportRowFailed
+			row.Error = "A movie with this imdb_id already exists"
+		default:
+			row.Status = models.ImportRowValid
+		}
+	}
+}
+
+func insertMovieBatch(ctx context.Context, movieCollection *mongo.Collection, batch []pendingMovie, report *models.MovieImportReport) {
+	documents := make([]models.Movie, 0, len(batch))
+	for _, pending := range batch {
+		documents = append(documents, pending.movie)
+	}
+
+	_, err := movieCollection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	applyBatchResult(batch, err, "Error while inserting movie", report, func(int) string {
+		return models.ImportRowCreated
+	})
+}
+
+func upsertMovieBatch(ctx context.Context, movieCollection *mongo.Collection, batch []pendingMovie, report *models.MovieImportReport) {
+	writes := make([]mongo.WriteModel, 0, len(batch))
+	for _, pending := range batch {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"imdb_id": pending.movie.ImdbID}).
+			SetUpdate(movieUpsert(pending.movie)).
+			SetUpsert(true))
+	}
+
+	result, err := movieCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	applyBatchResult(batch, err, "Error while saving movie", report, func(i int) string {
+		if result != nil {
+			if _, created := result.UpsertedIDs[int64(i)]; created {
+				return models.ImportRowCreated
+			}
+		}
+		return models.ImportRowUpdated
+	})
+}
+
+// applyBatchResult marks each row of a written batch. Write errors name the
+// rows they belong to; any other error fails the whole batch.
+func applyBatchResult(batch []pendingMovie, err error, failure string, report *models.MovieImportReport, written func(i int) string) {
+	rowErrors := map[int]string{}
+
+	var writeErr mongo.BulkWriteException
+	if errors.As(err, &writeErr) && writeErr.WriteConcernError == nil {
+		for _, failed := range writeErr.WriteErrors {
+			if mongo.IsDuplicateKeyError(failed.WriteError) {
+				rowErrors[failed.Index] = "A movie with this imdb_id already exists"
+			} else {
+				rowErrors[failed.Index] = failed.Message
+			}
+		}
+	} else if err != nil {
+		for i := range batch {
+			rowErrors[i] = failure
+		}
+	}
+
+	for i, pending := range batch {
+		row := &report.Rows[pending.row]
+		if message, failed := rowErrors[i]; failed {
+			row.Status = models.ImportRowFailed
+			row.Error = message
+			continue
+		}
+		row.Status = written(i)
+	}
+}
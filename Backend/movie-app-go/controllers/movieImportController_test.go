@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// importMovies posts body to ImportMovies and decodes the report.
+func importMovies(t *testing.T, router *gin.Engine, query, contentType string, body string) (int, models.MovieImportReport) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/movies/import"+query, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var report models.MovieImportReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("import answered %d with a body that isn't a report: %s", rec.Code, rec.Body.String())
+	}
+	return rec.Code, report
+}
+
+func importRow(imdbID string) string {
+	movie := models.Movie{
+		ImdbID:      imdbID,
+		Title:       "Movie " + imdbID,
+		PosterURL:   "https://example.com/" + imdbID + ".jpg",
+		YoutubeID:   "yt" + imdbID,
+		Genres:      []models.Genre{{GenreID: "18", GenreName: "Drama"}},
+		ReleaseYear: 1999,
+		Description: "A movie used by the import tests.",
+	}
+	data, _ := json.Marshal(movie)
+	return string(data)
+}
+
+func TestImportMoviesRejectsBodiesOverTheLimit(t *testing.T) {
+	router := newTestRouter()
+	router.POST("/movies/import", ImportMovies(offlineMongoClient(t)))
+
+	// A single row bigger than the limit never reaches the database
+	body := `[{"imdb_id":"tt1","description":"` + strings.Repeat("a", maxMovieImportBytes) + `"}]`
+
+	status, report := importMovies(t, router, "", "application/json", body)
+	if status != http.StatusBadRequest {
+		t.Fatalf("import = %d, want %d", status, http.StatusBadRequest)
+	}
+	if !strings.Contains(report.Error, "too large") {
+		t.Fatalf("report error = %q, want the body size limit", report.Error)
+	}
+	if report.Total != 0 {
+		t.Fatalf("report has %d rows, want none", report.Total)
+	}
+}
+
+func TestImportMoviesDryRunWritesNothing(t *testing.T) {
+	client := testMongoClient(t)
+
+	router := newTestRouter()
+	router.POST("/movies/import", ImportMovies(client))
+
+	movieCollection := database.OpenCollection(client, "movies")
+	if _, err := movieCollection.InsertOne(context.Background(), bson.M{"imdb_id": "tt0"}); err != nil {
+		t.Fatalf("inserting movie: %v", err)
+	}
+
+	body := strings.Join([]string{
+		importRow("tt0"),
+		importRow("tt1"),
+		`{"imdb_id":"tt2"}`,
+		importRow("tt1"),
+	}, "\n")
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{
+			query: "?dry_run=true",
+			want:  []string{models.ImportRowFailed, models.ImportRowValid, models.ImportRowInvalid, models.ImportRowInvalid},
+		},
+		{
+			query: "?dry_run=true&upsert=true",
+			want:  []string{models.ImportRowValid, models.ImportRowValid, models.ImportRowInvalid, models.ImportRowInvalid},
+		},
+	}
+
+	for _, tt := range tests {
+		status, report := importMovies(t, router, tt.query, "application/x-ndjson", body)
+		if status != http.StatusOK {
+			t.Fatalf("import%s = %d %+v, want %d", tt.query, status, report, http.StatusOK)
+		}
+		if !report.DryRun || report.Total != len(tt.want) {
+			t.Fatalf("import%s report = %+v, want a dry run of %d rows", tt.query, report, len(tt.want))
+		}
+		for i, row := range report.Rows {
+			if row.Row != i+1 || row.Status != tt.want[i] {
+				t.Errorf("import%s row %d = %+v, want row %d %s", tt.query, i, row, i+1, tt.want[i])
+			}
+		}
+		if report.Created+report.Updated != 0 {
+			t.Errorf("import%s created %d and updated %d movies in a dry run", tt.query, report.Created, report.Updated)
+		}
+
+		count, err := movieCollection.CountDocuments(context.Background(), bson.M{})
+		if err != nil {
+			t.Fatalf("counting movies: %v", err)
+		}
+		if count != 1 {
+			t.Fatalf("import%s left %d movies, want the 1 that was there", tt.query, count)
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+	"movie-app-go/utils"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"golang.org/x/oauth2"
+)
+
+const oidcStateCookie = "oidc_state"
+
+// oidcClaims are the ID token claims used to find or create the account.
+type oidcClaims struct {
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+}
+
+func oidcUnavailable(c *gin.Context, err error) {
+	if errors.Is(err, utils.ErrOIDCNotConfigured) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "OIDC login is not enabled"})
+		return
+	}
+	log.Printf("Error while loading OIDC provider: %v", err)
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Identity provider is unavailable"})
+}
+
+// @Summary Start an OpenID Connect login
+// @Tags auth
+// @Description Redirects to the identity provider using the authorization code flow with PKCE.
+// @Success 302
+// @Failure 404 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Failure 503 {object} map[string]any
+// @Router /api/v1/oidc/login [get]
+func OIDCLogin(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider, err := utils.GetOIDCClient()
+		if err != nil {
+			oidcUnavailable(c, err)
+			return
+		}
+
+		state, err := utils.NewOpaqueToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while starting OIDC login"})
+			return
+		}
+
+		nonce, err := utils.NewOpaqueToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while starting OIDC login"})
+			return
+		}
+
+		verifier := oauth2.GenerateVerifier()
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		if err := utils.SaveOIDCLoginState(ctx, client, state, nonce, verifier); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while starting OIDC login"})
+			return
+		}
+
+		// Ties the callback to the browser that started the login. Lax so it
+		// survives the top-level redirect back from the provider.
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     oidcStateCookie,
+			Value:    state,
+			Path:     "/api/v1/oidc",
+			MaxAge:   int(utils.OIDCLoginStateTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		c.Redirect(http.StatusFound, provider.OAuth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)))
+	}
+}
+
+// @Summary Finish an OpenID Connect login
+// @Tags auth
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State from the login redirect"
+// @Description Links the provider identity to the account with the same verified email, or creates a USER. Redirects to OIDC_POST_LOGIN_REDIRECT when set, otherwise answers like /login.
+// @Success 200 {object} models.LoginResponse
+// @Success 302
+// @Failure 400 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 404 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Failure 503 {object} map[string]any
+// @Router /api/v1/oidc/callback [get]
+func OIDCCallback(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provider, err := utils.GetOIDCClient()
+		if err != nil {
+			oidcUnavailable(c, err)
+			return
+		}
+
+		if providerErr := c.Query("error"); providerErr != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Identity provider refused the login: " + providerErr})
+			return
+		}
+
+		state := c.Query("state")
+		code := c.Query("code")
+		if state == "" || code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing code or state"})
+			return
+		}
+
+		cookieState, err := c.Cookie(oidcStateCookie)
+		if err != nil || subtle.ConstantTimeCompare([]byte(cookieState), []byte(state)) != 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired OIDC login state"})
+			return
+		}
+
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     oidcStateCookie,
+			Value:    "",
+			Path:     "/api/v1/oidc",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		loginState, err := utils.ConsumeOIDCLoginState(ctx, client, state)
+		if err != nil {
+			if errors.Is(err, utils.ErrInvalidOIDCState) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired OIDC login state"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while reading OIDC login state"})
+			return
+		}
+
+		idToken, claims, err := verifyOIDCCallback(ctx, provider, code, loginState)
+		if err != nil {
+			log.Printf("Error while finishing OIDC login: %v", err)
+			if errors.Is(err, errOIDCNoIDToken) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "OIDC login failed"})
+			return
+		}
+
+		users := mongoOIDCUsers{collection: database.OpenCollection(client, "users")}
+		foundUser, err := findOrCreateOIDCUser(ctx, users, provider.Issuer, idToken.Subject, claims)
+		if err != nil {
+			if errors.Is(err, errOIDCEmailNotVerified) {
+				auditLogin(c, client, "", "", claims.Email, "oidc", models.AuditOutcomeFailure, "email_not_verified")
+				c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while linking OIDC account"})
+			return
+		}
+
+		if foundUser.DeletedAt != nil {
+			auditLogin(c, client, foundUser.UserID, foundUser.Role, foundUser.Email, "oidc", models.AuditOutcomeFailure, "account_deleted")
+			accountDeleted(c, foundUser)
+			return
+		}
+
+		if accountBlocked(c, foundUser) {
+			auditLogin(c, client, foundUser.UserID, foundUser.Role, foundUser.Email, "oidc", models.AuditOutcomeFailure, foundUser.Status)
+			return
+		}
+
+		redirectURL := os.Getenv("OIDC_POST_LOGIN_REDIRECT")
+
+		// The provider vouches for the identity, not for our second factor
+		if foundUser.TOTPEnabled {
+			mfaToken, err := utils.GeneratePurposeToken(utils.TwoFactorChallengeAudience, foundUser.UserID, foundUser.Email, utils.TwoFactorChallengeTTL)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while generating tokens"})
+				return
+			}
+
+			if redirectURL != "" {
+				c.Redirect(http.StatusFound, redirectURL+"#mfa_token="+url.QueryEscape(mfaToken))
+				return
+			}
+			c.JSON(http.StatusOK, models.TwoFactorChallengeResponse{MfaRequired: true, MfaToken: mfaToken})
+			return
+		}
+
+		auditLogin(c, client, foundUser.UserID, foundUser.Role, foundUser.Email, "oidc", models.AuditOutcomeSuccess, "")
+
+		response, err := startSession(c, client, foundUser, false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Tokens travel in the cookies; nothing sensitive goes in the URL
+		if redirectURL != "" {
+			c.Redirect(http.StatusFound, redirectURL)
+			return
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+var errOIDCEmailNotVerified = errors.New("Identity provider did not verify an email address for this account")
+var errOIDCNoIDToken = errors.New("Identity provider did not return an ID token")
+var errOIDCNonceMismatch = errors.New("ID token nonce does not match the login")
+
+// verifyOIDCCallback redeems the code with the PKCE verifier saved when the
+// login started, then checks the ID token's signature, audience and nonce.
+func verifyOIDCCallback(ctx context.Context, provider *utils.OIDCClient, code string, loginState *models.OIDCLoginState) (*oidc.IDToken, oidcClaims, error) {
+	var claims oidcClaims
+
+	oauth2Token, err := provider.OAuth2.Exchange(ctx, code, oauth2.VerifierOption(loginState.CodeVerifier))
+	if err != nil {
+		return nil, claims, err
+	}
+
+	rawIDToken, ok := oauth2Token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, claims, errOIDCNoIDToken
+	}
+
+	idToken, err := provider.Verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, claims, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(loginState.Nonce)) != 1 {
+		return nil, claims, errOIDCNonceMismatch
+	}
+
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, claims, err
+	}
+
+	return idToken, claims, nil
+}
+
+// oidcUsers is the part of the users collection an OIDC login works with.
+// Lookups that find nothing return mongo.ErrNoDocuments.
+type oidcUsers interface {
+	findByIdentity(ctx context.Context, issuer, subject string) (models.User, error)
+	// linkByEmail adds identity to the account with this email, ignoring case.
+	linkByEmail(ctx context.Context, email string, identity models.OIDCIdentity) (models.User, error)
+	insert(ctx context.Context, user models.User) error
+}
+
+type mongoOIDCUsers struct {
+	collection *mongo.Collection
+}
+
+func (u mongoOIDCUsers) findByIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+	var foundUser models.User
+	err := u.collection.FindOne(ctx, bson.M{
+		"oidc_identities": bson.M{"$elemMatch": bson.M{"issuer": issuer, "subject": subject}},
+	}).Decode(&foundUser)
+	return foundUser, err
+}
+
+func (u mongoOIDCUsers) linkByEmail(ctx context.Context, email string, identity models.OIDCIdentity) (models.User, error) {
+	var foundUser models.User
+
+	// Providers don't keep the case the address was registered with. The
+	// oldest account wins if signups ever differed only in case.
+	err := u.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"email": email},
+		bson.M{
+			"$push":  bson.M{"oidc_identities": identity},
+			"$set":   bson.M{"pending_verification": false, "updated_at": time.Now()},
+			"$unset": bson.M{"verification_sent_at": ""},
+		},
+		options.FindOneAndUpdate().
+			SetCollation(utils.EmailCollation).
+			SetSort(bson.D{{Key: "created_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&foundUser)
+	return foundUser, err
+}
+
+func (u mongoOIDCUsers) insert(ctx context.Context, user models.User) error {
+	_, err := u.collection.InsertOne(ctx, user)
+	return err
+}
+
+// findOrCreateOIDCUser resolves the account for a provider subject. Known
+// subjects map straight to their account; otherwise the identity is linked to
+// the account with the same email, but only if the provider verified it, so
+// nobody can take over an account by claiming its address.
+func findOrCreateOIDCUser(ctx context.Context, users oidcUsers, issuer, subject string, claims oidcClaims) (models.User, error) {
+	foundUser, err := users.findByIdentity(ctx, issuer, subject)
+	if err == nil {
+		return foundUser, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return foundUser, err
+	}
+
+	email := strings.TrimSpace(claims.Email)
+	if email == "" || !claims.EmailVerified {
+		return foundUser, errOIDCEmailNotVerified
+	}
+
+	identity := models.OIDCIdentity{Issuer: issuer, Subject: subject, LinkedAt: time.Now()}
+
+	foundUser, err = users.linkByEmail(ctx, email, identity)
+	if err == nil {
+		return foundUser, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return foundUser, err
+	}
+
+	// New accounts get an unguessable password; a password can be set later
+	// through the reset flow.
+	randomPassword, err := utils.NewOpaqueToken()
+	if err != nil {
+		return foundUser, err
+	}
+	password, err := HashPassword(randomPassword)
+	if err != nil {
+		return foundUser, err
+	}
+
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" && lastName == "" {
+		firstName, lastName, _ = strings.Cut(claims.Name, " ")
+	}
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(email, "@")
+	}
+
+	foundUser = models.User{
+		UserID:              bson.NewObjectID().Hex(),
+		FirstName:           firstName,
+		LastName:            lastName,
+		Email:               email,
+		Password:            password,
+		Role:                models.RoleUser,
+		CreatedAt:           time.Now(),
+		UpdatedAt:           time.Now(),
+		FavouriteGenreIDs:   []string{},
+		PendingVerification: false,
+		TOTPEnabled:         false,
+		Status:              models.UserStatusActive,
+		OIDCIdentities:      []models.OIDCIdentity{identity},
+	}
+
+	if err := users.insert(ctx, foundUser); err != nil {
+		return foundUser, err
+	}
+
+	return foundUser, nil
+}
@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"movie-app-go/models"
+	"movie-app-go/utils"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"golang.org/x/oauth2"
+)
+
+const mockClientID = "movie-app"
+
+// mockIdP is a minimal OpenID provider: discovery, JWKS and a token endpoint
+// that only redeems codes with the PKCE verifier they were issued for.
+type mockIdP struct {
+	server *httptest.Server
+	keys   *utils.KeySet
+
+	mu     sync.Mutex
+	grants map[string]mockGrant
+}
+
+type mockGrant struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating IdP key: %v", err)
+	}
+	key := &utils.SigningKey{Kid: "idp-key", Method: jwt.SigningMethodRS256, Private: private, Public: &private.PublicKey}
+
+	idp := &mockIdP{keys: &utils.KeySet{}, grants: map[string]mockGrant{}}
+	idp.keys.Replace(key, []*utils.SigningKey{key})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, idp.keys.JWKS())
+	})
+	mux.HandleFunc("/token", idp.token)
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	idp.mu.Lock()
+	grant, ok := idp.grants[r.PostForm.Get("code")]
+	delete(idp.grants, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	key, _ := idp.keys.Active()
+	idToken := jwt.NewWithClaims(key.Method, grant.claims)
+	idToken.Header["kid"] = key.Kid
+	signed, err := idToken.SignedString(key.Private)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "idp-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     signed,
+	})
+}
+
+// authorize plays the browser leg of the flow: it follows our authorization
+// URL and returns the code the provider would redirect back with, together
+// with the login state we would have saved. Claims go into the ID token; the
+// nonce from the URL is used unless the claims set one.
+func (idp *mockIdP) authorize(t *testing.T, provider *utils.OIDCClient, claims jwt.MapClaims) (string, *models.OIDCLoginState) {
+	t.Helper()
+
+	loginState := &models.OIDCLoginState{Nonce: "nonce-" + utils.NewTokenFamilyID(), CodeVerifier: oauth2.GenerateVerifier()}
+
+	authURL, err := url.Parse(provider.OAuth2.AuthCodeURL("state", oidc.Nonce(loginState.Nonce), oauth2.S256ChallengeOption(loginState.CodeVerifier)))
+	if err != nil {
+		t.Fatalf("parsing authorization URL: %v", err)
+	}
+	query := authURL.Query()
+	if query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("authorization URL has no S256 code challenge: %s", authURL)
+	}
+
+	idTokenClaims := jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"aud":   query.Get("client_id"),
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": query.Get("nonce"),
+	}
+	for name, value := range claims {
+		idTokenClaims[name] = value
+	}
+
+	code := "code-" + utils.NewTokenFamilyID()
+	idp.mu.Lock()
+	idp.grants[code] = mockGrant{challenge: query.Get("code_challenge"), claims: idTokenClaims}
+	idp.mu.Unlock()
+
+	return code, loginState
+}
+
+// fakeOIDCUsers keeps users in memory and matches emails without regard to
+// case, like the collation used by mongoOIDCUsers.
+type fakeOIDCUsers struct {
+	users []models.User
+}
+
+func (f *fakeOIDCUsers) findByIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+	for _, user := range f.users {
+		for _, identity := range user.OIDCIdentities {
+			if identity.Issuer == issuer && identity.Subject == subject {
+				return user, nil
+			}
+		}
+	}
+	return models.User{}, mongo.ErrNoDocuments
+}
+
+func (f *fakeOIDCUsers) linkByEmail(ctx context.Context, email string, identity models.OIDCIdentity) (models.User, error) {
+	for i, user := range f.users {
+		if strings.EqualFold(user.Email, email) {
+			f.users[i].OIDCIdentities = append(f.users[i].OIDCIdentities, identity)
+			f.users[i].PendingVerification = false
+			return f.users[i], nil
+		}
+	}
+	return models.User{}, mongo.ErrNoDocuments
+}
+
+func (f *fakeOIDCUsers) insert(ctx context.Context, user models.User) error {
+	f.users = append(f.users, user)
+	return nil
+}
+
+func TestOIDCCallback(t *testing.T) {
+	idp := newMockIdP(t)
+
+	provider, err := utils.NewOIDCClient(idp.server.URL, mockClientID, "client-secret", "http://localhost:5000/api/v1/oidc/callback", []string{oidc.ScopeOpenID, "email"})
+	if err != nil {
+		t.Fatalf("discovering mock IdP: %v", err)
+	}
+
+	existing := models.User{UserID: "alice", Email: "alice@example.com", Role: models.RoleUser, PendingVerification: true}
+
+	tests := []struct {
+		name      string
+		claims    jwt.MapClaims
+		tamper    func(loginState *models.OIDCLoginState)
+		wantErr   error
+		wantCode  string
+		wantFail  bool
+		wantUser  string
+		wantUsers int
+	}{
+		{
+			name:      "verified email links the existing account ignoring case",
+			claims:    jwt.MapClaims{"sub": "subject-1", "email": "Alice@Example.COM", "email_verified": true},
+			wantUser:  "alice",
+			wantUsers: 1,
+		},
+		{
+			name:      "verified unknown email creates a user",
+			claims:    jwt.MapClaims{"sub": "subject-2", "email": "bob@example.com", "email_verified": true, "given_name": "Bob"},
+			wantUsers: 2,
+		},
+		{
+			name:      "unverified email is refused",
+			claims:    jwt.MapClaims{"sub": "subject-3", "email": "alice@example.com", "email_verified": false},
+			wantErr:   errOIDCEmailNotVerified,
+			wantUsers: 1,
+		},
+		{
+			name:     "nonce mismatch is refused",
+			claims:   jwt.MapClaims{"sub": "subject-4", "email": "alice@example.com", "email_verified": true, "nonce": "replayed"},
+			wantErr:  errOIDCNonceMismatch,
+			wantFail: true,
+		},
+		{
+			name:     "code exchange needs the PKCE verifier",
+			claims:   jwt.MapClaims{"sub": "subject-5", "email": "alice@example.com", "email_verified": true},
+			tamper:   func(loginState *models.OIDCLoginState) { loginState.CodeVerifier = oauth2.GenerateVerifier() },
+			wantCode: "invalid_grant",
+			wantFail: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			users := &fakeOIDCUsers{users: []models.User{existing}}
+
+			code, loginState := idp.authorize(t, provider, tt.claims)
+			if tt.tamper != nil {
+				tt.tamper(loginState)
+			}
+
+			idToken, claims, err := verifyOIDCCallback(ctx, provider, code, loginState)
+			if tt.wantFail {
+				if err == nil {
+					t.Fatal("verifyOIDCCallback succeeded, want an error")
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("verifyOIDCCallback error = %v, want %v", err, tt.wantErr)
+				}
+				var retrieveErr *oauth2.RetrieveError
+				if tt.wantCode != "" && (!errors.As(err, &retrieveErr) || retrieveErr.ErrorCode != tt.wantCode) {
+					t.Fatalf("verifyOIDCCallback error = %v, want the token endpoint to answer %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyOIDCCallback: %v", err)
+			}
+			if idToken.Subject != tt.claims["sub"] {
+				t.Fatalf("subject = %q, want %q", idToken.Subject, tt.claims["sub"])
+			}
+
+			user, err := findOrCreateOIDCUser(ctx, users, provider.Issuer, idToken.Subject, claims)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("findOrCreateOIDCUser error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("findOrCreateOIDCUser: %v", err)
+			}
+
+			if len(users.users) != tt.wantUsers {
+				t.Fatalf("%d users stored, want %d", len(users.users), tt.wantUsers)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if tt.wantUser != "" && user.UserID != tt.wantUser {
+				t.Fatalf("logged in as %q, want %q", user.UserID, tt.wantUser)
+			}
+			if user.PendingVerification {
+				t.Fatal("account still pending verification after a verified OIDC login")
+			}
+
+			// The linked identity signs in directly from now on
+			again, err := findOrCreateOIDCUser(ctx, users, provider.Issuer, idToken.Subject, oidcClaims{})
+			if err != nil || again.UserID != user.UserID {
+				t.Fatalf("second login = %q, %v; want %q", again.UserID, err, user.UserID)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/mailer"
+	"movie-app-go/models"
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// appBaseURL is where links sent by email point to, the React client by default.
+func appBaseURL() string {
+	if baseURL := os.Getenv("APP_BASE_URL"); baseURL != "" {
+		return baseURL
+	}
+	return "http://localhost:5173"
+}
+
+// @Summary Request a password reset email
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body models.ForgotPasswordRequest true "Account email"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/forgot-password [post]
+func ForgotPassword(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.ForgotPasswordRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Same answer whether or not the account exists, so emails can't be enumerated
+		response := gin.H{"message": "If an account exists for this email, a reset link has been sent"}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var userCollection = database.OpenCollection(client, "users")
+		var foundUser models.User
+
+		err := userCollection.FindOne(ctx, bson.M{"email": req.Email}, utils.FindUserByEmail()).Decode(&foundUser)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusOK, response)
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while looking up user"})
+			return
+		}
+
+		// Repeated requests get the same answer without another email, so the
+		// throttle doesn't reveal which emails have an account
+		claimed, err := utils.ClaimEmailSlot(ctx, client, foundUser.UserID, "password_reset_sent_at", utils.PasswordResetInterval())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while creating reset token"})
+			return
+		}
+		if !claimed {
+			c.JSON(http.StatusOK, response)
+			return
+		}
+
+		token, err := utils.CreatePasswordResetToken(foundUser.UserID, client)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while creating reset token"})
+			return
+		}
+
+		err = mailer.Default().Send(ctx, mailer.Message{
+			To:      foundUser.Email,
+			Subject: "Reset your Movie App password",
+			Body: "Hi " + foundUser.FirstName + ",\r\n\r\n" +
+				"Use the link below to choose a new password. It expires in 1 hour and can only be used once.\r\n\r\n" +
+				appBaseURL() + "/reset-password?token=" + token + "\r\n\r\n" +
+				"If you did not ask for this, you can ignore this email.",
+		})
+		if err != nil {
+			log.Printf("Error while sending password reset email: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while sending reset email"})
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// @Summary Reset password with a token received by email
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body models.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/reset-password [post]
+func ResetPassword(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.ResetPasswordRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		userId, err := utils.ConsumePasswordResetToken(req.Token, client)
+		if err != nil {
+			if errors.Is(err, utils.ErrInvalidResetToken) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while checking reset token"})
+			return
+		}
+
+		password, err := HashPassword(req.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while hashing password"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var userCollection = database.OpenCollection(client, "users")
+		result, err := userCollection.UpdateOne(ctx, bson.M{"user_id": userId}, bson.M{
+			"$set": bson.M{"password": password, "updated_at": time.Now()},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while updating password"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+
+		// Whoever held the old password must not keep a session
+		if err := revokeUserSessions(ctx, userId, client); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while revoking sessions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please log in again"})
+	}
+}
+
+// @Summary Change your password
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Description Logs out every session and starts a new one for the caller.
+// @Param body body models.ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} models.LoginResponse
+// @Failure 400 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 429 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/change-password [post]
+func ChangePassword(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetuserIdFromCtx(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+			return
+		}
+
+		var req models.ChangePasswordRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var userCollection = database.OpenCollection(client, "users")
+
+		var foundUser models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&foundUser); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while fetching user"})
+			return
+		}
+
+		// Shares the login counter so a stolen session can't brute-force the password here
+		emailKey := utils.EmailThrottleKey(foundUser.Email)
+
+		wait, err := utils.LoginBlockedFor(ctx, client, emailKey)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while checking login attempts"})
+			return
+		}
+		if wait > 0 {
+			tooManyAttempts(c, wait)
+			return
+		}
+
+		if ok, _, err := utils.VerifyPassword(foundUser.Password, req.CurrentPassword); err != nil || !ok {
+			if err := utils.RecordLoginFailure(ctx, client, emailKey); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while recording login attempt"})
+				return
+			}
+			c.JSON(http.StatusForbidden, gin.H{"error": "Current password is incorrect"})
+			return
+		}
+
+		if _, err := utils.ResetLoginFailures(ctx, client, emailKey); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while recording login attempt"})
+			return
+		}
+
+		password, err := HashPassword(req.NewPassword)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while hashing password"})
+			return
+		}
+
+		_, err = userCollection.UpdateOne(ctx, bson.M{"user_id": userID}, bson.M{
+			"$set": bson.M{"password": password, "updated_at": time.Now()},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while updating password"})
+			return
+		}
+
+		if err := revokeUserSessions(ctx, userID, client); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while revoking sessions"})
+			return
+		}
+
+		// Keep the caller logged in on a fresh session
+		completeLogin(c, client, foundUser, c.GetBool("twoFactor"))
+	}
+}
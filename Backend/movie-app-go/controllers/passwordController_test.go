@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+	"movie-app-go/utils"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var resetLink = regexp.MustCompile(`/reset-password\?token=(\S+)`)
+
+// insertTestUser stores an active, verified account with the given password.
+func insertTestUser(t *testing.T, client *mongo.Client, email, password string) models.User {
+	t.Helper()
+
+	hashed, err := HashPassword(password)
+	if err != nil {
+		t.Fatalf("hashing password: %v", err)
+	}
+
+	now := time.Now()
+	user := models.User{
+		UserID:    bson.NewObjectID().Hex(),
+		FirstName: "Bob",
+		LastName:  "Builder",
+		Email:     email,
+		Password:  hashed,
+		Role:      models.RoleUser,
+		Status:    models.UserStatusActive,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if _, err := database.OpenCollection(client, "users").InsertOne(context.Background(), user); err != nil {
+		t.Fatalf("inserting user: %v", err)
+	}
+	return user
+}
+
+// storedPassword returns the password hash currently saved for the user.
+func storedPassword(t *testing.T, client *mongo.Client, userId string) string {
+	t.Helper()
+
+	var user models.User
+	err := database.OpenCollection(client, "users").FindOne(context.Background(), bson.M{"user_id": userId}).Decode(&user)
+	if err != nil {
+		t.Fatalf("loading user: %v", err)
+	}
+	return user.Password
+}
+
+func TestPasswordResetFlow(t *testing.T) {
+	client := testMongoClient(t)
+	useTestKeys(t)
+	outbox := useOutbox(t)
+
+	router := newTestRouter()
+	router.POST("/api/v1/forgot-password", ForgotPassword(client))
+	router.POST("/api/v1/reset-password", ResetPassword(client))
+
+	user := insertTestUser(t, client, "bob@example.com", "old password 1")
+
+	familyId := utils.NewTokenFamilyID()
+	accessToken, refreshToken, err := utils.GenerateAllTokens(user.UserID, user.FirstName, user.LastName, user.Email, user.Role, familyId, false)
+	if err != nil {
+		t.Fatalf("generating tokens: %v", err)
+	}
+	if err := utils.CreateSession(user.UserID, familyId, refreshToken, "test", "127.0.0.1", client); err != nil {
+		t.Fatalf("creating session: %v", err)
+	}
+
+	// Unknown emails, known ones and throttled repeats all look the same
+	unknownStatus, unknownBody := serveJSON(t, router, http.MethodPost, "/api/v1/forgot-password", map[string]any{"email": "nobody@example.com"})
+	knownStatus, knownBody := serveJSON(t, router, http.MethodPost, "/api/v1/forgot-password", map[string]any{"email": user.Email})
+	repeatStatus, repeatBody := serveJSON(t, router, http.MethodPost, "/api/v1/forgot-password", map[string]any{"email": user.Email})
+
+	if knownStatus != http.StatusOK {
+		t.Fatalf("forgot-password = %d %v, want %d", knownStatus, knownBody, http.StatusOK)
+	}
+	if unknownStatus != knownStatus || !reflect.DeepEqual(unknownBody, knownBody) {
+		t.Fatalf("unknown email answered %d %v, known email %d %v", unknownStatus, unknownBody, knownStatus, knownBody)
+	}
+	if repeatStatus != knownStatus || !reflect.DeepEqual(repeatBody, knownBody) {
+		t.Fatalf("repeated request answered %d %v, first one %d %v", repeatStatus, repeatBody, knownStatus, knownBody)
+	}
+
+	links := outboxLinks(t, outbox, resetLink)
+	if len(links) != 1 {
+		t.Fatalf("outbox has %d reset links, want 1", len(links))
+	}
+
+	// User cutoffs are kept in whole seconds, so move past the second the
+	// session was issued in before resetting
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	const newPassword = "new password 2"
+	status, body := serveJSON(t, router, http.MethodPost, "/api/v1/reset-password", map[string]any{"token": links[0], "password": newPassword})
+	if status != http.StatusOK {
+		t.Fatalf("reset-password = %d %v, want %d", status, body, http.StatusOK)
+	}
+
+	if ok, _, err := utils.VerifyPassword(storedPassword(t, client, user.UserID), newPassword); err != nil || !ok {
+		t.Fatalf("new password doesn't verify: ok=%v err=%v", ok, err)
+	}
+
+	status, body = serveJSON(t, router, http.MethodPost, "/api/v1/reset-password", map[string]any{"token": links[0], "password": "third password 3"})
+	if status != http.StatusBadRequest {
+		t.Fatalf("reset-password with a used token = %d %v, want %d", status, body, http.StatusBadRequest)
+	}
+	if ok, _, _ := utils.VerifyPassword(storedPassword(t, client, user.UserID), newPassword); !ok {
+		t.Fatal("a used token changed the password again")
+	}
+
+	var family models.TokenFamily
+	err = database.OpenCollection(client, "token_families").FindOne(context.Background(), bson.M{"family_id": familyId}).Decode(&family)
+	if err != nil {
+		t.Fatalf("loading session: %v", err)
+	}
+	if !family.Revoked {
+		t.Fatal("session can still be refreshed after a password reset")
+	}
+
+	claims, err := utils.ValidateToken(accessToken)
+	if err != nil {
+		t.Fatalf("validating access token: %v", err)
+	}
+	revoked, err := utils.Revocations.IsRevoked(context.Background(), claims)
+	if err != nil {
+		t.Fatalf("checking revocation: %v", err)
+	}
+	if !revoked {
+		t.Fatal("access token still valid after a password reset")
+	}
+}
+
+func TestPasswordResetRefusesExpiredTokens(t *testing.T) {
+	client := testMongoClient(t)
+	useTestKeys(t)
+
+	router := newTestRouter()
+	router.POST("/api/v1/reset-password", ResetPassword(client))
+
+	const oldPassword = "old password 1"
+	user := insertTestUser(t, client, "carol@example.com", oldPassword)
+
+	token, err := utils.CreatePasswordResetToken(user.UserID, client)
+	if err != nil {
+		t.Fatalf("creating reset token: %v", err)
+	}
+
+	_, err = database.OpenCollection(client, "password_resets").UpdateOne(context.Background(),
+		bson.M{"token_hash": utils.HashToken(token)},
+		bson.M{"$set": bson.M{"expires_at": time.Now().Add(-time.Minute)}},
+	)
+	if err != nil {
+		t.Fatalf("expiring reset token: %v", err)
+	}
+
+	status, body := serveJSON(t, router, http.MethodPost, "/api/v1/reset-password", map[string]any{"token": token, "password": "new password 2"})
+	if status != http.StatusBadRequest {
+		t.Fatalf("reset-password with an expired token = %d %v, want %d", status, body, http.StatusBadRequest)
+	}
+	if ok, _, _ := utils.VerifyPassword(storedPassword(t, client, user.UserID), oldPassword); !ok {
+		t.Fatal("an expired token changed the password")
+	}
+}
@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"movie-app-go/models"
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+func listSessions(c *gin.Context, client *mongo.Client, userID, currentFamilyId string) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	families, err := utils.ListUserSessions(ctx, userID, client)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while fetching sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toSessions(families, currentFamilyId))
+}
+
+// callerSessionOf returns the caller's session id when userID is the caller,
+// and "" when an admin is looking at someone else's sessions.
+func callerSessionOf(c *gin.Context, userID string) string {
+	if callerID, err := utils.GetuserIdFromCtx(c); err != nil || callerID != userID {
+		return ""
+	}
+	return c.GetString("familyId")
+}
+
+func toSessions(families []models.TokenFamily, currentFamilyId string) []models.Session {
+	sessions := make([]models.Session, 0, len(families))
+	for _, family := range families {
+		sessions = append(sessions, models.Session{
+			SessionID:       family.FamilyID,
+			UserAgent:       family.UserAgent,
+			IP:              family.IP,
+			CreatedAt:       family.CreatedAt,
+			LastRefreshedAt: family.LastRefreshedAt,
+			ExpiresAt:       family.ExpiresAt,
+			Current:         family.FamilyID == currentFamilyId,
+		})
+	}
+	return sessions
+}
+
+func revokeSession(c *gin.Context, client *mongo.Client, userID, sessionID string) bool {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	found, err := utils.RevokeUserSession(ctx, userID, sessionID, client)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while revoking session"})
+		return false
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return false
+	}
+	return true
+}
+
+func revokeOtherSessions(c *gin.Context, client *mongo.Client, userID, keepFamilyId string) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+	defer cancel()
+
+	revoked, err := utils.RevokeOtherSessions(ctx, userID, keepFamilyId, client)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while revoking sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked", "revoked": revoked})
+}
+
+// @Summary List your sessions
+// @Tags sessions
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {array} models.Session
+// @Failure 401 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/sessions [get]
+func GetSessions(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetuserIdFromCtx(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+			return
+		}
+
+		listSessions(c, client, userID, c.GetString("familyId"))
+	}
+}
+
+// @Summary Revoke one of your sessions
+// @Tags sessions
+// @Produce json
+// @Security ApiKeyAuth
+// @Description Revoking the current session logs the caller out.
+// @Param sessionId path string true "Session ID"
+// @Success 200 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 404 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/sessions/{sessionId} [delete]
+func RevokeSession(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetuserIdFromCtx(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+			return
+		}
+
+		sessionID := c.Param("sessionId")
+		if !revokeSession(c, client, userID, sessionID) {
+			return
+		}
+
+		if sessionID == c.GetString("familyId") {
+			clearAuthCookies(c)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+	}
+}
+
+// @Summary Revoke all your other sessions
+// @Tags sessions
+// @Produce json
+// @Security ApiKeyAuth
+// @Description Logs out every device except the one making the request.
+// @Success 200 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/sessions [delete]
+func RevokeOtherSessions(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetuserIdFromCtx(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+			return
+		}
+
+		revokeOtherSessions(c, client, userID, c.GetString("familyId"))
+	}
+}
+
+// @Summary List a user's sessions
+// @Tags sessions
+// @Produce json
+// @Security ApiKeyAuth
+// @Param userId path string true "User ID"
+// @Success 200 {array} models.Session
+// @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/users/{userId}/sessions [get]
+func GetUserSessions(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Param("userId")
+		listSessions(c, client, userID, callerSessionOf(c, userID))
+	}
+}
+
+// @Summary Revoke a user's session
+// @Tags sessions
+// @Produce json
+// @Security ApiKeyAuth
+// @Param userId path string true "User ID"
+// @Param sessionId path string true "Session ID"
+// @Success 200 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 404 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/users/{userId}/sessions/{sessionId} [delete]
+func RevokeUserSession(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !revokeSession(c, client, c.Param("userId"), c.Param("sessionId")) {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+	}
+}
+
+// @Summary Revoke all of a user's sessions
+// @Tags sessions
+// @Produce json
+// @Security ApiKeyAuth
+// @Description Keeps the caller's own session when an admin targets themselves.
+// @Param userId path string true "User ID"
+// @Success 200 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/users/{userId}/sessions [delete]
+func RevokeAllUserSessions(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Param("userId")
+		revokeOtherSessions(c, client, userID, callerSessionOf(c, userID))
+	}
+}
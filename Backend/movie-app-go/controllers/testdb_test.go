@@ -0,0 +1,189 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"movie-app-go/mailer"
+	"movie-app-go/secrets"
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// testMongoClient connects to the MongoDB at MONGO_TEST_URI and points
+// database.OpenCollection at a fresh database that is dropped afterwards.
+// Tests using it are skipped when MONGO_TEST_URI isn't set.
+func testMongoClient(t *testing.T) *mongo.Client {
+	t.Helper()
+
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI not set")
+	}
+
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connecting to MongoDB: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatalf("pinging MongoDB: %v", err)
+	}
+
+	dbName := useTestDatabase(t)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		client.Database(dbName).Drop(ctx)
+		client.Disconnect(ctx)
+	})
+
+	return client
+}
+
+// offlineMongoClient returns a client for a server that isn't there, for
+// handlers that must give up before touching the database.
+func offlineMongoClient(t *testing.T) *mongo.Client {
+	t.Helper()
+
+	client, err := mongo.Connect(options.Client().ApplyURI("mongodb://127.0.0.1:1").SetServerSelectionTimeout(time.Second))
+	if err != nil {
+		t.Fatalf("creating MongoDB client: %v", err)
+	}
+	useTestDatabase(t)
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+
+	return client
+}
+
+// useTestDatabase points database.OpenCollection at a database named for
+// this test and returns its name.
+func useTestDatabase(t *testing.T) string {
+	t.Helper()
+
+	// OpenCollection loads .env, which doesn't override variables already set
+	dbName := "movie_app_test_" + bson.NewObjectID().Hex()
+	t.Setenv("MONGO_DB_NAME", dbName)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), nil, 0o600); err != nil {
+		t.Fatalf("writing .env: %v", err)
+	}
+	t.Chdir(dir)
+
+	return dbName
+}
+
+// useTestKeys signs tokens with a throwaway key and revokes them in memory.
+func useTestKeys(t *testing.T) {
+	t.Helper()
+
+	key, err := utils.NewEphemeralSigningKey()
+	if err != nil {
+		t.Fatalf("generating signing key: %v", err)
+	}
+	previousActive, _ := utils.Keys.Active()
+	previousKeys := utils.Keys.All()
+	utils.Keys.Replace(key, []*utils.SigningKey{key})
+	t.Cleanup(func() { utils.Keys.Replace(previousActive, previousKeys) })
+
+	previousRevocations := utils.Revocations
+	utils.Revocations = utils.NewMemoryRevocationStore()
+	t.Cleanup(func() { utils.Revocations = previousRevocations })
+
+	t.Setenv(utils.JWT_REFRESH_SECRET_KEY, "t3st-R3fr3sh-k3y-9f2Lq8Zr1Tx7Vb4Nm6Wc")
+	if err := secrets.Default.Load(); err != nil {
+		t.Fatalf("loading secrets: %v", err)
+	}
+}
+
+// useOutbox sends every email of the test to a temporary outbox directory.
+func useOutbox(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	previous := mailer.Default()
+	mailer.SetDefault(mailer.OutboxMailer{Dir: dir, From: "no-reply@movieapp.local"})
+	t.Cleanup(func() { mailer.SetDefault(previous) })
+	return dir
+}
+
+// outboxLinks returns the tokens of every link matching pattern, oldest
+// email first. pattern must capture the token.
+func outboxLinks(t *testing.T, dir string, pattern *regexp.Regexp) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("reading outbox: %v", err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	tokens := []string{}
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("reading %s: %v", name, err)
+		}
+		for _, match := range pattern.FindAllSubmatch(data, -1) {
+			tokens = append(tokens, string(match[1]))
+		}
+	}
+	return tokens
+}
+
+// serveJSON sends body as JSON and decodes the JSON answer.
+func serveJSON(t *testing.T, router http.Handler, method, path string, body any) (int, map[string]any) {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body == nil {
+		reader = bytes.NewReader(nil)
+	} else {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("encoding request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var response map[string]any
+	if rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s %s answered %d with a body that isn't JSON: %s", method, path, rec.Code, rec.Body.String())
+		}
+	}
+	return rec.Code, response
+}
+
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(gin.Recovery())
+	return router
+}
@@ -0,0 +1,365 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const recoveryCodeCount = 10
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code and
+// burns what was used, so neither can be presented twice.
+func checkSecondFactor(ctx context.Context, client *mongo.Client, user models.User, code, recoveryCode string) (bool, error) {
+	var userCollection = database.OpenCollection(client, "users")
+
+	if code != "" {
+		step, ok := utils.VerifyTOTP(user.TOTPSecret, code, user.TOTPLastStep)
+		if !ok {
+			return false, nil
+		}
+
+		result, err := userCollection.UpdateOne(
+			ctx,
+			bson.M{
+				"user_id": user.UserID,
+				"$or": bson.A{
+					bson.M{"totp_last_step": bson.M{"$exists": false}},
+					bson.M{"totp_last_step": bson.M{"$lt": step}},
+				},
+			},
+			bson.M{"$set": bson.M{"totp_last_step": step}},
+		)
+		if err != nil {
+			return false, err
+		}
+		return result.MatchedCount == 1, nil
+	}
+
+	hash := utils.HashToken(utils.NormalizeRecoveryCode(recoveryCode))
+	result, err := userCollection.UpdateOne(
+		ctx,
+		bson.M{"user_id": user.UserID, "recovery_code_hashes": hash},
+		bson.M{"$pull": bson.M{"recovery_code_hashes": hash}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount == 1, nil
+}
+
+// @Summary Start TOTP enrollment
+// @Tags 2fa
+// @Produce json
+// @Security ApiKeyAuth
+// @Success 200 {object} models.TwoFactorEnrollResponse
+// @Failure 401 {object} map[string]any
+// @Failure 409 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/2fa/enroll [post]
+func EnrollTwoFactor(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetuserIdFromCtx(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var userCollection = database.OpenCollection(client, "users")
+
+		var foundUser models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&foundUser); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		if foundUser.TOTPEnabled {
+			c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+			return
+		}
+
+		secret, err := utils.NewTOTPSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while generating secret"})
+			return
+		}
+
+		// Only becomes active once a first code proves the app was set up
+		_, err = userCollection.UpdateOne(ctx, bson.M{"user_id": userID}, bson.M{
+			"$set": bson.M{"totp_pending_secret": secret, "updated_at": time.Now()},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while saving secret"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.TwoFactorEnrollResponse{
+			Secret:     secret,
+			OtpauthURI: utils.TOTPURI(secret, foundUser.Email),
+		})
+	}
+}
+
+// @Summary Confirm TOTP enrollment with a first code
+// @Tags 2fa
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param body body models.TwoFactorCodeRequest true "Code from the authenticator app"
+// @Success 200 {object} models.TwoFactorConfirmResponse
+// @Failure 400 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/2fa/confirm [post]
+func ConfirmTwoFactor(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetuserIdFromCtx(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+			return
+		}
+
+		var req models.TwoFactorCodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if req.Code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Code is required"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var userCollection = database.OpenCollection(client, "users")
+
+		var foundUser models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&foundUser); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		if foundUser.TOTPPendingSecret == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "No two-factor enrollment in progress"})
+			return
+		}
+
+		step, ok := utils.VerifyTOTP(foundUser.TOTPPendingSecret, req.Code, 0)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+			return
+		}
+
+		recoveryCodes, err := utils.NewRecoveryCodes(recoveryCodeCount)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while generating recovery codes"})
+			return
+		}
+
+		hashes := make([]string, 0, len(recoveryCodes))
+		for _, code := range recoveryCodes {
+			hashes = append(hashes, utils.HashToken(code))
+		}
+
+		_, err = userCollection.UpdateOne(ctx, bson.M{"user_id": userID, "totp_pending_secret": foundUser.TOTPPendingSecret}, bson.M{
+			"$set": bson.M{
+				"totp_enabled":         true,
+				"totp_secret":          foundUser.TOTPPendingSecret,
+				"totp_last_step":       step,
+				"recovery_code_hashes": hashes,
+				"updated_at":           time.Now(),
+			},
+			"$unset": bson.M{"totp_pending_secret": ""},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while enabling two-factor authentication"})
+			return
+		}
+
+		// Recovery codes are only ever shown here
+		c.JSON(http.StatusOK, models.TwoFactorConfirmResponse{RecoveryCodes: recoveryCodes})
+	}
+}
+
+// @Summary Disable TOTP
+// @Tags 2fa
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param body body models.TwoFactorCodeRequest true "Current code or a recovery code"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/2fa/disable [post]
+func DisableTwoFactor(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := utils.GetuserIdFromCtx(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in context"})
+			return
+		}
+
+		var req models.TwoFactorCodeRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var userCollection = database.OpenCollection(client, "users")
+
+		var foundUser models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&foundUser); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		if !foundUser.TOTPEnabled {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+			return
+		}
+
+		if foundUser.Role == models.RoleAdmin && utils.AdminTwoFactorRequired() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admins must keep two-factor authentication enabled"})
+			return
+		}
+
+		ok, err := checkSecondFactor(ctx, client, foundUser, req.Code, req.RecoveryCode)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while checking code"})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+			return
+		}
+
+		_, err = userCollection.UpdateOne(ctx, bson.M{"user_id": userID}, bson.M{
+			"$set":   bson.M{"totp_enabled": false, "updated_at": time.Now()},
+			"$unset": bson.M{"totp_secret": "", "totp_last_step": "", "recovery_code_hashes": ""},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while disabling two-factor authentication"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+	}
+}
+
+// @Summary Finish a login with a TOTP or recovery code
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body models.TwoFactorLoginRequest true "Challenge from /login and a code"
+// @Success 200 {object} models.LoginResponse
+// @Failure 400 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 429 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/login/2fa [post]
+func LoginTwoFactor(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.TwoFactorLoginRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		claims, err := utils.ValidatePurposeToken(req.MfaToken, utils.TwoFactorChallengeAudience)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var userCollection = database.OpenCollection(client, "users")
+
+		var foundUser models.User
+		err = userCollection.FindOne(ctx, bson.M{"user_id": claims.Subject}).Decode(&foundUser)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while looking up user"})
+			return
+		}
+
+		if !foundUser.TOTPEnabled || foundUser.DeletedAt != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired login challenge"})
+			return
+		}
+
+		if accountBlocked(c, foundUser) {
+			return
+		}
+
+		throttleKey := utils.TwoFactorThrottleKey(foundUser.UserID)
+
+		wait, err := utils.LoginBlockedFor(ctx, client, throttleKey)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while checking login attempts"})
+			return
+		}
+		if wait > 0 {
+			auditLogin(c, client, foundUser.UserID, foundUser.Role, foundUser.Email, "2fa", models.AuditOutcomeFailure, "throttled")
+			tooManyAttempts(c, wait)
+			return
+		}
+
+		ok, err := checkSecondFactor(ctx, client, foundUser, req.Code, req.RecoveryCode)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while checking code"})
+			return
+		}
+		if !ok {
+			if err := utils.RecordLoginFailure(ctx, client, throttleKey); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while recording login attempt"})
+				return
+			}
+			auditLogin(c, client, foundUser.UserID, foundUser.Role, foundUser.Email, "2fa", models.AuditOutcomeFailure, "invalid_code")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+			return
+		}
+
+		if _, err := utils.ResetLoginFailures(ctx, client, throttleKey); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while recording login attempt"})
+			return
+		}
+
+		auditLogin(c, client, foundUser.UserID, foundUser.Role, foundUser.Email, "2fa", models.AuditOutcomeSuccess, "")
+		completeLogin(c, client, foundUser, true)
+	}
+}
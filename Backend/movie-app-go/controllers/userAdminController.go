@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// findManagedUser loads the target of an admin action. Admins can't act on
+// their own account, so nobody can lock themselves out or lift their own
+// suspension.
+func findManagedUser(ctx context.Context, c *gin.Context, client *mongo.Client, userID string) (models.User, bool) {
+	var foundUser models.User
+
+	if callerID, _ := utils.GetuserIdFromCtx(c); callerID == userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admins can't change their own account this way"})
+		return foundUser, false
+	}
+
+	var userCollection = database.OpenCollection(client, "users")
+
+	err := userCollection.FindOne(
+		ctx,
+		bson.M{"user_id": userID},
+		options.FindOne().SetProjection(bson.M{"user_id": 1, "role": 1, "status": 1}),
+	).Decode(&foundUser)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return foundUser, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while fetching user"})
+		return foundUser, false
+	}
+
+	return foundUser, true
+}
+
+// @Summary Suspend, ban or reactivate a user
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Description Suspended and banned users are signed out and refused with the codes account_suspended and account_banned until the optional until time. The reason is shown to the user and kept in the audit log.
+// @Param userId path string true "User ID"
+// @Param body body models.UpdateUserStatusRequest true "New status"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 404 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/users/{userId}/status [put]
+func UpdateUserStatus(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Param("userId")
+		var req models.UpdateUserStatusRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if req.Until != nil && req.Status == models.UserStatusActive {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "until only applies to suspensions and bans"})
+			return
+		}
+		if req.Until != nil && !req.Until.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "until must be in the future"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		foundUser, ok := findManagedUser(ctx, c, client, userID)
+		if !ok {
+			return
+		}
+
+		update := bson.M{}
+		if req.Status == models.UserStatusActive {
+			update["$set"] = bson.M{"status": req.Status, "updated_at": time.Now()}
+			update["$unset"] = bson.M{"status_reason": "", "status_until": ""}
+		} else {
+			set := bson.M{"status": req.Status, "status_reason": req.Reason, "updated_at": time.Now()}
+			if req.Until != nil {
+				set["status_until"] = *req.Until
+			} else {
+				update["$unset"] = bson.M{"status_until": ""}
+			}
+			update["$set"] = set
+		}
+
+		var userCollection = database.OpenCollection(client, "users")
+		if _, err := userCollection.UpdateOne(ctx, bson.M{"user_id": userID}, update); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while updating user status"})
+			return
+		}
+
+		details := map[string]any{"from": foundUser.Status, "to": req.Status, "reason": req.Reason}
+		if foundUser.Status == "" {
+			details["from"] = models.UserStatusActive
+		}
+		if req.Until != nil {
+			details["until"] = *req.Until
+		}
+		utils.RecordAuditEvent(c, client, models.AuditEvent{
+			Action:     models.AuditActionUserStatus,
+			TargetType: "user",
+			TargetID:   userID,
+			Outcome:    models.AuditOutcomeSuccess,
+			Details:    details,
+		})
+
+		// Signed-in sessions must not outlive the suspension or ban
+		if req.Status != models.UserStatusActive {
+			if err := revokeUserSessions(ctx, userID, client); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while revoking user tokens"})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "User status updated", "status": req.Status})
+	}
+}
+
+// @Summary Change the role of a user
+// @Tags users
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Description The user is signed out everywhere so new tokens carry the new role. The reason is kept in the audit log.
+// @Param userId path string true "User ID"
+// @Param body body models.UpdateUserRoleRequest true "New role"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} map[string]any
+// @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 404 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/users/{userId}/role [put]
+func UpdateUserRole(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.Param("userId")
+		var req models.UpdateUserRoleRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		foundUser, ok := findManagedUser(ctx, c, client, userID)
+		if !ok {
+			return
+		}
+
+		if foundUser.Role == req.Role {
+			c.JSON(http.StatusOK, gin.H{"message": "User already has this role", "role": req.Role})
+			return
+		}
+
+		var userCollection = database.OpenCollection(client, "users")
+		_, err := userCollection.UpdateOne(
+			ctx,
+			bson.M{"user_id": userID},
+			bson.M{"$set": bson.M{"role": req.Role, "updated_at": time.Now()}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while updating user role"})
+			return
+		}
+
+		utils.RecordAuditEvent(c, client, models.AuditEvent{
+			Action:     models.AuditActionRoleChange,
+			TargetType: "user",
+			TargetID:   userID,
+			Outcome:    models.AuditOutcomeSuccess,
+			Details:    map[string]any{"from": foundUser.Role, "to": req.Role, "reason": req.Reason},
+		})
+
+		// Tokens carry the role
+		if err := revokeUserSessions(ctx, userID, client); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while revoking user tokens"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "User role updated", "role": req.Role})
+	}
+}
@@ -2,8 +2,11 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"movie-app-go/database"
@@ -14,57 +17,123 @@ import (
 	"github.com/go-playground/validator/v10"
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
-	"golang.org/x/crypto/bcrypt"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
+// HashPassword hashes with the current default algorithm, see
+// utils.PasswordHashers.
 func HashPassword(password string) (string, error) {
-	HashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return utils.HashPassword(password)
+}
+
+// checkPassword verifies a login password. A hash that no longer matches the
+// current algorithm or parameters is replaced; failing to do so only gets
+// logged since the password itself was right.
+func checkPassword(ctx context.Context, client *mongo.Client, user models.User, password string) bool {
+	ok, needsRehash, err := utils.VerifyPassword(user.Password, password)
+	if err != nil {
+		log.Printf("Error while verifying password of user %s: %v", user.UserID, err)
+		return false
+	}
+	if !ok || !needsRehash {
+		return ok
+	}
 
+	rehashed, err := HashPassword(password)
 	if err != nil {
-		return "", err
+		log.Printf("Error while rehashing password of user %s: %v", user.UserID, err)
+		return true
 	}
 
-	return string(HashedPassword), nil
+	var userCollection = database.OpenCollection(client, "users")
+
+	// Matching the old hash keeps a concurrent password change from being overwritten
+	_, err = userCollection.UpdateOne(
+		ctx,
+		bson.M{"user_id": user.UserID, "password": user.Password},
+		bson.M{"$set": bson.M{"password": rehashed}},
+	)
+	if err != nil {
+		log.Printf("Error while rehashing password of user %s: %v", user.UserID, err)
+	}
+	return true
 }
 
 // @Summary Register a new user
 // @Tags auth
 // @Accept json
 // @Produce json
-// @Param body body models.User true "User"
+// @Param body body models.SignupRequest true "User"
 // @Success 201 {object} map[string]any
+// @Description Send the guest token along to keep the genres picked as a guest. Only USER accounts can be registered.
 // @Failure 400 {object} map[string]any
+// @Failure 403 {object} map[string]any
 // @Failure 409 {object} map[string]any
 // @Failure 500 {object} map[string]any
 // @Router /api/v1/register [post]
 func Signup(client *mongo.Client) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var user models.User
+		var req models.SignupRequest
 
-		if err := c.ShouldBindJSON(&user); err != nil {
+		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
+		// GUEST is reserved for anonymous tokens and admins are appointed by admins
+		if req.Role != "" && req.Role != models.RoleUser {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only USER accounts can be registered"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second) // 100 seconds timeout
+		defer cancel()                                                               // Ensure the context is cancelled to avoid memory leaks
+
+		// A guest signing up keeps the genres picked while browsing
+		guestClaims := guestFromRequest(c)
+		if guestClaims != nil {
+			guest, err := utils.GetGuest(ctx, client, guestClaims.UserId)
+			if err != nil && !errors.Is(err, utils.ErrGuestNotFound) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while loading guest session"})
+				return
+			}
+			if err == nil {
+				req.FavouriteGenreIDs = mergeGenreIDs(req.FavouriteGenreIDs, utils.GenreIDs(guest.FavouriteMoviesGenres))
+			}
+		}
+
 		validate := validator.New()
-		if err := validate.Struct(user); err != nil {
+		if err := validate.Struct(req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		password, err := HashPassword(user.Password) // Hash the user's password
+		user := models.User{
+			FirstName: req.FirstName,
+			LastName:  req.LastName,
+			Email:     req.Email,
+			Role:      models.RoleUser,
+		}
 
+		// Only references are stored; names always come from the genres collection
+		genres, err := utils.ValidateGenreIDs(ctx, client, req.FavouriteGenreIDs)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while hashing password"})
+			genreError(c, err)
 			return
 		}
+		user.FavouriteMoviesGenres = genres
+		user.FavouriteGenreIDs = utils.GenreIDs(genres)
 
-		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second) // 100 seconds timeout
-		defer cancel()                                                               // Ensure the context is cancelled to avoid memory leaks
+		password, err := HashPassword(req.Password) // Hash the user's password
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while hashing password"})
+			return
+		}
 
 		var userCollection = database.OpenCollection(client, "users")
 
-		count, err := userCollection.CountDocuments(ctx, bson.M{"email": user.Email}) // Check for existing user with the same email
+		count, err := userCollection.CountDocuments(ctx, bson.M{"email": user.Email}, options.Count().SetCollation(utils.EmailCollation)) // Check for existing user with the same email, in any case
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while checking for existing user"})
 			return
@@ -81,12 +150,32 @@ func Signup(client *mongo.Client) gin.HandlerFunc {
 		user.CreatedAt = time.Now()
 		user.UpdatedAt = time.Now()
 
+		user.PendingVerification = true // Stays pending until the emailed link is opened
+		user.VerificationSentAt = time.Now()
+		user.Status = models.UserStatusActive
+
 		data, err := userCollection.InsertOne(ctx, user) // Insert the new user into the database
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while creating user"})
 			return
 		}
 
+		// The account exists either way; a failed email can be resent later
+		if err := sendVerificationEmail(ctx, user); err != nil {
+			log.Printf("Error while sending verification email: %v", err)
+		}
+
+		// The guest session has been upgraded and is no longer needed
+		if guestClaims != nil {
+			if err := utils.DeleteGuest(ctx, client, guestClaims.UserId); err != nil {
+				log.Printf("Error while deleting guest session: %v", err)
+			}
+			if err := utils.RevokeAccessToken(ctx, guestClaims); err != nil {
+				log.Printf("Error while revoking guest token: %v", err)
+			}
+			clearAuthCookies(c)
+		}
+
 		c.JSON(http.StatusCreated, gin.H{"data": data})
 	}
 }
@@ -96,9 +185,12 @@ func Signup(client *mongo.Client) gin.HandlerFunc {
 // @Accept json
 // @Produce json
 // @Param body body models.UserLogin true "Credentials"
+// @Description Returns a TwoFactorChallengeResponse instead when the account has 2FA enabled; finish with /login/2fa.
 // @Success 200 {object} models.LoginResponse
 // @Failure 400 {object} map[string]any
 // @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 429 {object} map[string]any
 // @Failure 500 {object} map[string]any
 // @Router /api/v1/login [post]
 func Login(client *mongo.Client) gin.HandlerFunc {
@@ -113,73 +205,213 @@ func Login(client *mongo.Client) gin.HandlerFunc {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
+		emailKey := utils.EmailThrottleKey(userLogin.Email)
+		ipKey := utils.IPThrottleKey(c.ClientIP())
+
+		wait, err := utils.LoginBlockedFor(ctx, client, emailKey, ipKey)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while checking login attempts"})
+			return
+		}
+		if wait > 0 {
+			auditLogin(c, client, "", "", userLogin.Email, "password", models.AuditOutcomeFailure, "throttled")
+			tooManyAttempts(c, wait)
+			return
+		}
+
 		var userCollection = database.OpenCollection(client, "users")
 		var foundUser models.User
 
-		err := userCollection.FindOne(ctx, bson.M{"email": userLogin.Email}).Decode(&foundUser)
+		err = userCollection.FindOne(ctx, bson.M{"email": userLogin.Email}, utils.FindUserByEmail()).Decode(&foundUser)
+		if err == nil && !checkPassword(ctx, client, foundUser, userLogin.Password) {
+			err = errors.New("invalid password")
+		}
 		if err != nil {
+			if err := utils.RecordLoginFailure(ctx, client, emailKey, ipKey); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while recording login attempt"})
+				return
+			}
+			auditLogin(c, client, foundUser.UserID, foundUser.Role, userLogin.Email, "password", models.AuditOutcomeFailure, "invalid_credentials")
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 			return
 		}
-		err = bcrypt.CompareHashAndPassword([]byte(foundUser.Password), []byte(userLogin.Password))
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+
+		// The IP counter is left alone so one valid account can't reset it
+		if _, err := utils.ResetLoginFailures(ctx, client, emailKey); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while recording login attempt"})
 			return
 		}
 
-		accessToken, refreshToken, err := utils.GenerateAllTokens(foundUser.UserID, foundUser.FirstName, foundUser.LastName, foundUser.Email, foundUser.Role)
+		if foundUser.DeletedAt != nil {
+			auditLogin(c, client, foundUser.UserID, foundUser.Role, foundUser.Email, "password", models.AuditOutcomeFailure, "account_deleted")
+			accountDeleted(c, foundUser)
+			return
+		}
 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while generating tokens"})
+		if accountBlocked(c, foundUser) {
+			auditLogin(c, client, foundUser.UserID, foundUser.Role, foundUser.Email, "password", models.AuditOutcomeFailure, foundUser.Status)
 			return
 		}
 
-		err = utils.UpdateAllTokens(foundUser.UserID, accessToken, refreshToken, client)
+		if foundUser.PendingVerification && utils.EmailVerificationRequired() {
+			auditLogin(c, client, foundUser.UserID, foundUser.Role, foundUser.Email, "password", models.AuditOutcomeFailure, "email_not_verified")
+			c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+			return
+		}
 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while updating tokens"})
+		// With 2FA enabled the password only earns a short-lived challenge
+		if foundUser.TOTPEnabled {
+			mfaToken, err := utils.GeneratePurposeToken(utils.TwoFactorChallengeAudience, foundUser.UserID, foundUser.Email, utils.TwoFactorChallengeTTL)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while generating tokens"})
+				return
+			}
+
+			c.JSON(http.StatusOK, models.TwoFactorChallengeResponse{MfaRequired: true, MfaToken: mfaToken})
 			return
 		}
 
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:     "access_token",
-			Value:    accessToken,
-			Path:     "/",
-			MaxAge:   3600,
-			HttpOnly: true,
-			Secure:   true,
-			SameSite: http.SameSiteNoneMode,
-		})
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:     "refresh_token",
-			Value:    refreshToken,
-			Path:     "/",
-			MaxAge:   7200,
-			HttpOnly: true,
-			Secure:   true,
-			SameSite: http.SameSiteNoneMode,
-		})
-
-		c.JSON(http.StatusOK, models.LoginResponse{
-			UserId:                foundUser.UserID,
-			FirstName:             foundUser.FirstName,
-			LastName:              foundUser.LastName,
-			Email:                 foundUser.Email,
-			Role:                  foundUser.Role,
-			AccessToken:           accessToken,
-			RefreshToken:          refreshToken,
-			FavouriteMoviesGenres: foundUser.FavouriteMoviesGenres,
-		})
+		auditLogin(c, client, foundUser.UserID, foundUser.Role, foundUser.Email, "password", models.AuditOutcomeSuccess, "")
+		completeLogin(c, client, foundUser, false)
+	}
+}
+
+// genreError answers a request naming genres that don't exist with 400.
+func genreError(c *gin.Context, err error) {
+	var unknown *utils.UnknownGenresError
+	if errors.As(err, &unknown) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": unknown.Error(), "unknown_genre_ids": unknown.IDs})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while checking genres"})
+}
+
+// tooManyAttempts answers a throttled login, telling the client when to retry.
+func tooManyAttempts(c *gin.Context, wait time.Duration) {
+	tooManyRequests(c, wait, "Too many failed login attempts, try again later")
+}
+
+func tooManyRequests(c *gin.Context, wait time.Duration, message string) {
+	seconds := int(wait.Round(time.Second).Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": message, "retry_after": seconds})
+}
+
+// completeLogin starts a new session for a user who passed every login step
+// and writes the LoginResponse.
+func completeLogin(c *gin.Context, client *mongo.Client, foundUser models.User, twoFactor bool) {
+	response, err := startSession(c, client, foundUser, twoFactor)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// startSession issues a token pair in a new refresh token family and sets the
+// token cookies.
+func startSession(c *gin.Context, client *mongo.Client, foundUser models.User, twoFactor bool) (models.LoginResponse, error) {
+	familyId := utils.NewTokenFamilyID() // Every login starts a new refresh token family
+
+	accessToken, refreshToken, err := utils.GenerateAllTokens(foundUser.UserID, foundUser.FirstName, foundUser.LastName, foundUser.Email, foundUser.Role, familyId, twoFactor)
+
+	if err != nil {
+		return models.LoginResponse{}, errors.New("Error while generating tokens")
+	}
+
+	err = utils.CreateSession(foundUser.UserID, familyId, refreshToken, c.Request.UserAgent(), c.ClientIP(), client)
+
+	if err != nil {
+		return models.LoginResponse{}, errors.New("Error while updating tokens")
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     "access_token",
+		Value:    accessToken,
+		Path:     "/",
+		MaxAge:   3600,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+	})
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     "refresh_token",
+		Value:    refreshToken,
+		Path:     "/",
+		MaxAge:   7200,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+	})
+
+	csrfToken, err := utils.GenerateCSRFToken(familyId)
+	if err != nil {
+		return models.LoginResponse{}, errors.New("Error while generating tokens")
+	}
+
+	genres, err := utils.ResolveGenres(c.Request.Context(), client, foundUser.FavouriteGenreIDs)
+	if err != nil {
+		return models.LoginResponse{}, errors.New("Error while loading favourite genres")
+	}
+
+	return models.LoginResponse{
+		UserId:                foundUser.UserID,
+		FirstName:             foundUser.FirstName,
+		LastName:              foundUser.LastName,
+		Email:                 foundUser.Email,
+		Role:                  foundUser.Role,
+		AccessToken:           accessToken,
+		RefreshToken:          refreshToken,
+		CSRFToken:             csrfToken,
+		FavouriteMoviesGenres: genres,
+	}, nil
+}
+
+// revokeUserSessions invalidates every access token and refresh token family
+// issued to the user so far.
+func revokeUserSessions(ctx context.Context, userId string, client *mongo.Client) error {
+	if err := utils.Revocations.RevokeUserTokens(ctx, userId); err != nil {
+		return err
 	}
+	return utils.RevokeUserTokenFamilies(userId, client)
+}
+
+func clearAuthCookies(c *gin.Context) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     "access_token",
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+	})
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     "refresh_token",
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+	})
 }
 
 // @Summary Logout
 // @Tags auth
 // @Accept json
 // @Produce json
+// @Description When the session cookies are sent, the X-CSRF-Token header of that session is required.
 // @Param body body models.UserLogout true "Logout"
+// @Param X-CSRF-Token header string false "CSRF token of the session, required with session cookies"
 // @Success 200 {object} map[string]any
 // @Failure 400 {object} map[string]any
+// @Failure 403 {object} map[string]any
 // @Failure 500 {object} map[string]any
 // @Router /api/v1/logout [post]
 func Logout(client *mongo.Client) gin.HandlerFunc {
@@ -193,32 +425,54 @@ func Logout(client *mongo.Client) gin.HandlerFunc {
 		}
 		fmt.Println("User ID:", UserLogout.UserId)
 
-		err = utils.UpdateAllTokens(UserLogout.UserId, "", "", client) // Clear tokens in the database
+		ctx := c.Request.Context()
+
+		var loggedOut *utils.SigninDetails
+
+		// Only this session ends; the user's other devices stay logged in.
+		// The caller has to prove to be that user.
+		if accessToken, err := utils.GetAcessToken(c); err == nil && accessToken != "" {
+			claims, err := utils.ValidateToken(accessToken)
+			if err == nil && claims.UserId == UserLogout.UserId {
+				loggedOut = claims
+				if claims.ID != "" {
+					err = utils.RevokeAccessToken(ctx, claims)
+				}
+				if err == nil && claims.FamilyId != "" {
+					err = utils.RevokeSession(ctx, claims.FamilyId, client)
+				}
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while logging out"})
+					return
+				}
+			}
+		}
 
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while logging out"})
-			return
-		}
-
-		// Clear cookies
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:     "access_token",
-			Value:    "",
-			Path:     "/",
-			MaxAge:   -1,
-			HttpOnly: true,
-			Secure:   true,
-			SameSite: http.SameSiteNoneMode,
-		})
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:     "refresh_token",
-			Value:    "",
-			Path:     "/",
-			MaxAge:   -1,
-			HttpOnly: true,
-			Secure:   true,
-			SameSite: http.SameSiteNoneMode,
-		})
+		// Revoke the session of the refresh cookie too so it can't be replayed
+		if refreshToken, err := c.Cookie("refresh_token"); err == nil && refreshToken != "" {
+			claims, err := utils.ValidateRefreshToken(refreshToken)
+			if err == nil && claims.UserId == UserLogout.UserId && claims.FamilyId != "" {
+				loggedOut = claims
+				if err := utils.RevokeSession(ctx, claims.FamilyId, client); err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while logging out"})
+					return
+				}
+			}
+		}
+
+		clearAuthCookies(c)
+
+		// Only logouts that actually ended a session are worth recording
+		if loggedOut != nil {
+			utils.RecordAuditEvent(c, client, models.AuditEvent{
+				ActorID:    loggedOut.UserId,
+				ActorRole:  loggedOut.Role,
+				Action:     models.AuditActionLogout,
+				TargetType: "session",
+				TargetID:   loggedOut.FamilyId,
+				Outcome:    models.AuditOutcomeSuccess,
+			})
+		}
 
 		c.JSON(http.StatusOK, gin.H{"message": "Successfully logged out"})
 	}
@@ -228,8 +482,9 @@ func Logout(client *mongo.Client) gin.HandlerFunc {
 // @Tags users
 // @Produce json
 // @Security ApiKeyAuth
-// @Success 200 {object} map[string]any
+// @Success 200 {object} models.AdminUserListResponse
 // @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
 // @Failure 500 {object} map[string]any
 // @Router /api/v1/users [get]
 func GetUsers(client *mongo.Client) gin.HandlerFunc {
@@ -239,19 +494,38 @@ func GetUsers(client *mongo.Client) gin.HandlerFunc {
 
 		var userCollection = database.OpenCollection(client, "users")
 
-		cursor, err := userCollection.Find(ctx, bson.M{})
+		cursor, err := userCollection.Find(ctx, bson.M{}, options.Find().SetProjection(models.AdminUserProjection))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while fetching users"})
 			return
 		}
 		defer cursor.Close(ctx)
 
-		var users []models.User
+		users := []models.AdminUserResponse{}
 		if err = cursor.All(ctx, &users); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while decoding users"})
 			return
 		}
 
+		// One lookup for the genres of every user
+		genreIDs := []string{}
+		for _, user := range users {
+			genreIDs = append(genreIDs, user.FavouriteGenreIDs...)
+		}
+		genres, err := utils.GenresByID(ctx, client, genreIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while fetching genres"})
+			return
+		}
+		for i := range users {
+			users[i].FavouriteMoviesGenres = []models.Genre{}
+			for _, id := range users[i].FavouriteGenreIDs {
+				if genre, ok := genres[id]; ok {
+					users[i].FavouriteMoviesGenres = append(users[i].FavouriteMoviesGenres, genre)
+				}
+			}
+		}
+
 		c.JSON(http.StatusOK, gin.H{"data": users})
 	}
 }
@@ -260,9 +534,11 @@ func GetUsers(client *mongo.Client) gin.HandlerFunc {
 // @Tags users
 // @Produce json
 // @Security ApiKeyAuth
+// @Description Admins also get the deletion state of the account.
 // @Param userId path string true "User ID"
-// @Success 200 {object} map[string]any
+// @Success 200 {object} models.UserDetailResponse
 // @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
 // @Failure 404 {object} map[string]any
 // @Failure 500 {object} map[string]any
 // @Router /api/v1/getuserbyID/{userId} [get]
@@ -275,14 +551,31 @@ func GetUserByID(client *mongo.Client) gin.HandlerFunc {
 
 		var userCollection = database.OpenCollection(client, "users")
 
-		var foundUser models.User
-		err := userCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&foundUser)
+		// Owners get the public view, admins the admin view
+		var foundUser models.AdminUserResponse
+		projection := models.UserProjection
+		role, _ := utils.GetRoleFromCtx(c)
+		if role == models.RoleAdmin {
+			projection = models.AdminUserProjection
+		}
+
+		err := userCollection.FindOne(ctx, bson.M{"user_id": userID}, options.FindOne().SetProjection(projection)).Decode(&foundUser)
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"data": foundUser})
+		foundUser.FavouriteMoviesGenres, err = utils.ResolveGenres(ctx, client, foundUser.FavouriteGenreIDs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while fetching genres"})
+			return
+		}
+
+		if role == models.RoleAdmin {
+			c.JSON(http.StatusOK, gin.H{"data": foundUser})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"data": foundUser.UserResponse})
 	}
 }
 
@@ -296,6 +589,9 @@ func GetUserByID(client *mongo.Client) gin.HandlerFunc {
 // @Success 200 {object} map[string]any
 // @Failure 400 {object} map[string]any
 // @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 404 {object} map[string]any
+// @Failure 409 {object} map[string]any
 // @Failure 500 {object} map[string]any
 // @Router /api/v1/updateuser/{userId} [put]
 func UpdateUser(client *mongo.Client) gin.HandlerFunc {
@@ -307,6 +603,38 @@ func UpdateUser(client *mongo.Client) gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+
+		if err := validate.Struct(user); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if user.Password != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Use /change-password to change the password"})
+			return
+		}
+
+		// Role changes need a justification, see UpdateUserRole
+		if user.Role != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Use PUT /api/v1/users/{userId}/role to change the role"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var userCollection = database.OpenCollection(client, "users")
+
+		var foundUser models.User
+		if err := userCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&foundUser); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while fetching user"})
+			return
+		}
+
 		update := bson.M{}
 		set := bson.M{}
 
@@ -316,34 +644,60 @@ func UpdateUser(client *mongo.Client) gin.HandlerFunc {
 		if user.LastName != nil {
 			set["last_name"] = *user.LastName
 		}
-		if user.Email != nil {
+
+		emailChanged := user.Email != nil && *user.Email != foundUser.Email
+		if emailChanged {
+			// Same collation as Signup, so no one can take an address in another case
+			count, err := userCollection.CountDocuments(
+				ctx,
+				bson.M{"email": *user.Email, "user_id": bson.M{"$ne": userID}},
+				options.Count().SetCollation(utils.EmailCollation),
+			)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while checking for existing user"})
+				return
+			}
+			if count > 0 {
+				c.JSON(http.StatusConflict, gin.H{"error": "User with this email already exists"})
+				return
+			}
+
+			// The new address has to be verified like the one given at signup
 			set["email"] = *user.Email
+			set["pending_verification"] = true
+			set["verification_sent_at"] = time.Now()
 		}
-		if user.Password != nil {
-			set["password"] = *user.Password
-		}
-		if user.Role != nil {
-			set["role"] = *user.Role
-		}
-		if user.FavouriteMoviesGenres != nil {
-			set["favourite_movies_genres"] = *user.FavouriteMoviesGenres
+
+		if user.FavouriteGenreIDs != nil {
+			genres, err := utils.ValidateGenreIDs(ctx, client, *user.FavouriteGenreIDs)
+			if err != nil {
+				genreError(c, err)
+				return
+			}
+			set["favourite_genre_ids"] = utils.GenreIDs(genres)
 		}
 
 		if len(set) > 0 {
+			set["updated_at"] = time.Now()
 			update["$set"] = set
 		}
 
 		if len(update) > 0 {
-			var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-			defer cancel()
-
-			var userCollection = database.OpenCollection(client, "users")
-
 			_, err := userCollection.UpdateOne(ctx, bson.M{"user_id": userID}, update) // Update the user in the database
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while updating user"})
 				return
 			}
+
+			if emailChanged {
+				foundUser.Email = *user.Email
+				if user.FirstName != nil {
+					foundUser.FirstName = *user.FirstName
+				}
+				if err := sendVerificationEmail(ctx, foundUser); err != nil {
+					log.Printf("Error while sending verification email: %v", err)
+				}
+			}
 		}
 
 		c.JSON(http.StatusOK, gin.H{"message": "User updated successfully"})
@@ -354,9 +708,12 @@ func UpdateUser(client *mongo.Client) gin.HandlerFunc {
 // @Tags users
 // @Produce json
 // @Security ApiKeyAuth
+// @Description Marks the account as deleted and signs it out everywhere. It can be restored until purge_at, after which its data is purged.
 // @Param userId path string true "User ID"
-// @Success 200 {object} map[string]any
+// @Success 200 {object} models.DeleteUserResponse
 // @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
+// @Failure 404 {object} map[string]any
 // @Failure 500 {object} map[string]any
 // @Router /api/v1/deleteuser/{userId} [delete]
 func DeleteUser(client *mongo.Client) gin.HandlerFunc {
@@ -369,13 +726,49 @@ func DeleteUser(client *mongo.Client) gin.HandlerFunc {
 
 			var userCollection = database.OpenCollection(client, "users")
 
-			_, err := userCollection.DeleteOne(ctx, bson.M{"user_id": userID}) // Delete the user from the database
+			// The account is only marked; the purger removes it once the grace
+			// period is over, until then it can be restored.
+			now := time.Now()
+			purgeAt := now.Add(utils.AccountDeletionGracePeriod())
+
+			result, err := userCollection.UpdateOne(
+				ctx,
+				bson.M{"user_id": userID, "deleted_at": bson.M{"$exists": false}},
+				bson.M{"$set": bson.M{"deleted_at": now, "purge_at": purgeAt, "updated_at": now}},
+			)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while deleting user"})
 				return
 			}
 
-			c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+			if result.MatchedCount == 0 {
+				c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+				return
+			}
+
+			utils.RecordAuditEvent(c, client, models.AuditEvent{
+				Action:     models.AuditActionUserDelete,
+				TargetType: "user",
+				TargetID:   userID,
+				Outcome:    models.AuditOutcomeSuccess,
+				Details:    map[string]any{"purge_at": purgeAt},
+			})
+
+			if err := revokeUserSessions(ctx, userID, client); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while revoking user tokens"})
+				return
+			}
+
+			if err := utils.DeleteUserAPIKeys(ctx, userID, client); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while revoking API keys"})
+				return
+			}
+
+			if callerID, _ := utils.GetuserIdFromCtx(c); callerID == userID {
+				clearAuthCookies(c)
+			}
+
+			c.JSON(http.StatusOK, models.DeleteUserResponse{Message: "User deleted successfully", PurgeAt: purgeAt})
 		}
 	}
 }
@@ -383,8 +776,11 @@ func DeleteUser(client *mongo.Client) gin.HandlerFunc {
 // @Summary Refresh tokens
 // @Tags auth
 // @Produce json
+// @Description Uses the refresh_token cookie, so the X-CSRF-Token header of that session is required.
+// @Param X-CSRF-Token header string true "CSRF token of the session"
 // @Success 200 {object} map[string]any
 // @Failure 401 {object} map[string]any
+// @Failure 403 {object} map[string]any
 // @Failure 500 {object} map[string]any
 // @Router /api/v1/refresh-token [post]
 func RefreshToken(client *mongo.Client) gin.HandlerFunc {
@@ -407,20 +803,29 @@ func RefreshToken(client *mongo.Client) gin.HandlerFunc {
 		var userCollection = database.OpenCollection(client, "users")
 		var foundUser models.User
 
-		err = userCollection.FindOne(ctx, bson.M{"user_id": claims.UserId}).Decode(&foundUser)
+		err = userCollection.FindOne(ctx, bson.M{"user_id": claims.UserId, "deleted_at": bson.M{"$exists": false}}).Decode(&foundUser)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			return
 		}
 
-		newAccessToken, newRefreshToken, err := utils.GenerateAllTokens(foundUser.UserID, foundUser.FirstName, foundUser.LastName, foundUser.Email, foundUser.Role)
+		if accountBlocked(c, foundUser) {
+			return
+		}
+
+		newAccessToken, newRefreshToken, err := utils.GenerateAllTokens(foundUser.UserID, foundUser.FirstName, foundUser.LastName, foundUser.Email, foundUser.Role, claims.FamilyId, claims.TwoFactor)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while generating tokens"})
 			return
 		}
 
-		err = utils.UpdateAllTokens(foundUser.UserID, newAccessToken, newRefreshToken, client)
+		err = utils.RotateRefreshToken(claims.FamilyId, refreshToken, newRefreshToken, c.ClientIP(), client)
 		if err != nil {
+			if errors.Is(err, utils.ErrRefreshTokenReused) || errors.Is(err, utils.ErrTokenFamilyRevoked) {
+				clearAuthCookies(c)
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token is no longer valid, please log in again"})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while updating tokens"})
 			return
 		}
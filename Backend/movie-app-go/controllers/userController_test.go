@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// leakMarker is stored in every secret field; no response may contain it.
+const leakMarker = "leak-marker-6f1c"
+
+// secretKeys are stored next to public fields and must never be sent back.
+var secretKeys = []string{
+	"password", "token", "access_token", "refresh_token", "totp_secret",
+	"totp_pending_secret", "totp_last_step", "recovery_code_hashes",
+	"password_reset_sent_at", "key_hash", "token_hash",
+}
+
+// insertUserWithSecrets stores a user with every secret field filled in,
+// legacy token fields included, along with an API key and a session.
+func insertUserWithSecrets(t *testing.T, client *mongo.Client, userId, role string) {
+	t.Helper()
+
+	ctx := context.Background()
+	now := time.Now()
+
+	_, err := database.OpenCollection(client, "users").InsertOne(ctx, bson.M{
+		"user_id":                userId,
+		"first_name":             "Dana",
+		"last_name":              "Scully",
+		"email":                  userId + "@example.com",
+		"role":                   role,
+		"status":                 models.UserStatusActive,
+		"created_at":             now,
+		"updated_at":             now,
+		"favourite_genre_ids":    bson.A{},
+		"password":               leakMarker,
+		"token":                  leakMarker,
+		"access_token":           leakMarker,
+		"refresh_token":          leakMarker,
+		"totp_enabled":           true,
+		"totp_secret":            leakMarker,
+		"totp_pending_secret":    leakMarker,
+		"totp_last_step":         int64(6172),
+		"recovery_code_hashes":   bson.A{leakMarker},
+		"password_reset_sent_at": now,
+	})
+	if err != nil {
+		t.Fatalf("inserting user: %v", err)
+	}
+
+	_, err = database.OpenCollection(client, "api_keys").InsertOne(ctx, models.APIKey{
+		KeyID:     bson.NewObjectID().Hex(),
+		UserID:    userId,
+		Name:      "ci",
+		Prefix:    "mak_1234",
+		KeyHash:   leakMarker,
+		Scopes:    []string{models.ScopeMoviesRead},
+		CreatedAt: now,
+	})
+	if err != nil {
+		t.Fatalf("inserting API key: %v", err)
+	}
+
+	_, err = database.OpenCollection(client, "token_families").InsertOne(ctx, models.TokenFamily{
+		FamilyID:  bson.NewObjectID().Hex(),
+		UserID:    userId,
+		TokenHash: leakMarker,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("inserting session: %v", err)
+	}
+}
+
+// assertNoSecrets fails when a response holds a secret key or value.
+func assertNoSecrets(t *testing.T, name string, body map[string]any) {
+	t.Helper()
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("encoding %s response: %v", name, err)
+	}
+	if strings.Contains(string(data), leakMarker) {
+		t.Errorf("%s response leaks a stored secret: %s", name, data)
+	}
+
+	var decoded any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("decoding %s response: %v", name, err)
+	}
+	keys := map[string]bool{}
+	collectKeys(decoded, keys)
+	for _, secret := range secretKeys {
+		if keys[secret] {
+			t.Errorf("%s response has a %q field: %s", name, secret, data)
+		}
+	}
+}
+
+func collectKeys(value any, keys map[string]bool) {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, nested := range value {
+			keys[key] = true
+			collectKeys(nested, keys)
+		}
+	case []any:
+		for _, nested := range value {
+			collectKeys(nested, keys)
+		}
+	}
+}
+
+func TestUserResponsesHideSecrets(t *testing.T) {
+	client := testMongoClient(t)
+
+	const userId = "user-with-secrets"
+	insertUserWithSecrets(t, client, userId, models.RoleUser)
+	insertUserWithSecrets(t, client, "admin-with-secrets", models.RoleAdmin)
+
+	// Stands in for AuthenticationMiddleware
+	as := func(userId, role string) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Set("userId", userId)
+			c.Set("role", role)
+			c.Next()
+		}
+	}
+
+	router := newTestRouter()
+	router.GET("/user/getuserbyID/:userId", as(userId, models.RoleUser), GetUserByID(client))
+	router.GET("/user/me/export", as(userId, models.RoleUser), ExportUserData(client))
+	router.GET("/admin/getuserbyID/:userId", as("admin-with-secrets", models.RoleAdmin), GetUserByID(client))
+	router.GET("/admin/users", as("admin-with-secrets", models.RoleAdmin), GetUsers(client))
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "GetUserByID as the owner", path: "/user/getuserbyID/" + userId},
+		{name: "GetUserByID as an admin", path: "/admin/getuserbyID/" + userId},
+		{name: "GetUsers", path: "/admin/users"},
+		{name: "ExportUserData", path: "/user/me/export"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := serveJSON(t, router, http.MethodGet, tt.path, nil)
+			if status != http.StatusOK {
+				t.Fatalf("GET %s = %d %v, want %d", tt.path, status, body, http.StatusOK)
+			}
+			assertNoSecrets(t, tt.name, body)
+		})
+	}
+
+	// The export still holds the API key and the session, only without hashes
+	_, export := serveJSON(t, router, http.MethodGet, "/user/me/export", nil)
+	if keys, _ := export["api_keys"].([]any); len(keys) != 1 {
+		t.Errorf("export has api_keys %v, want the one key", export["api_keys"])
+	}
+	if sessions, _ := export["sessions"].([]any); len(sessions) != 1 {
+		t.Errorf("export has sessions %v, want the one session", export["sessions"])
+	}
+}
+
+func TestEmailsAreUniqueInAnyCase(t *testing.T) {
+	client := testMongoClient(t)
+	useTestKeys(t)
+	useOutbox(t)
+
+	router := newTestRouter()
+	router.POST("/api/v1/register", Signup(client))
+	router.POST("/api/v1/login", Login(client))
+	router.PUT("/api/v1/updateuser/:userId", UpdateUser(client))
+
+	register := func(email string) (int, map[string]any) {
+		return serveJSON(t, router, http.MethodPost, "/api/v1/register", map[string]any{
+			"first_name":          "Erin",
+			"last_name":           "Hart",
+			"email":               email,
+			"password":            "correct horse battery",
+			"favourite_genre_ids": []string{},
+		})
+	}
+
+	if status, body := register("Erin@Example.com"); status != http.StatusCreated {
+		t.Fatalf("register = %d %v, want %d", status, body, http.StatusCreated)
+	}
+	if status, body := register("erin@example.com"); status != http.StatusConflict {
+		t.Fatalf("register in another case = %d %v, want %d", status, body, http.StatusConflict)
+	}
+
+	other := insertTestUser(t, client, "frank@example.com", "correct horse battery")
+	status, body := serveJSON(t, router, http.MethodPut, "/api/v1/updateuser/"+other.UserID, map[string]any{"email": "ERIN@example.com"})
+	if status != http.StatusConflict {
+		t.Fatalf("update to a taken email in another case = %d %v, want %d", status, body, http.StatusConflict)
+	}
+
+	status, body = serveJSON(t, router, http.MethodPost, "/api/v1/login", map[string]any{"email": "erin@EXAMPLE.com", "password": "correct horse battery"})
+	if status != http.StatusOK {
+		t.Fatalf("login in another case = %d %v, want %d", status, body, http.StatusOK)
+	}
+}
@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/mailer"
+	"movie-app-go/models"
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// apiBaseURL is where links that hit the API directly point to.
+func apiBaseURL() string {
+	if baseURL := os.Getenv("API_BASE_URL"); baseURL != "" {
+		return baseURL
+	}
+	return "http://localhost:5000/api/v1"
+}
+
+func sendVerificationEmail(ctx context.Context, user models.User) error {
+	token, err := utils.GeneratePurposeToken(utils.EmailVerificationAudience, user.UserID, user.Email, utils.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	return mailer.Default().Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Movie App email address",
+		Body: "Hi " + user.FirstName + ",\r\n\r\n" +
+			"Please confirm your email address by opening the link below. It expires in 24 hours.\r\n\r\n" +
+			apiBaseURL() + "/verify-email?token=" + token + "\r\n",
+	})
+}
+
+// @Summary Verify an email address
+// @Tags auth
+// @Produce json
+// @Param token query string true "Verification token from the email"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/verify-email [get]
+func VerifyEmail(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Verification token is required"})
+			return
+		}
+
+		claims, err := utils.ValidatePurposeToken(token, utils.EmailVerificationAudience)
+		if err != nil || claims.Email == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+			return
+		}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var userCollection = database.OpenCollection(client, "users")
+
+		// The token is only good for the address it was sent to, and only once
+		result, err := userCollection.UpdateOne(
+			ctx,
+			bson.M{"user_id": claims.Subject, "email": claims.Email, "pending_verification": true},
+			bson.M{
+				"$set":   bson.M{"pending_verification": false, "updated_at": time.Now()},
+				"$unset": bson.M{"verification_sent_at": ""},
+			},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while verifying email"})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+	}
+}
+
+// @Summary Resend the verification email
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body models.ResendVerificationRequest true "Account email"
+// @Success 200 {object} map[string]any
+// @Failure 400 {object} map[string]any
+// @Failure 429 {object} map[string]any
+// @Failure 500 {object} map[string]any
+// @Router /api/v1/resend-verification [post]
+func ResendVerification(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.ResendVerificationRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := validate.Struct(req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		response := gin.H{"message": "If this account is awaiting verification, a new email has been sent"}
+
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		var userCollection = database.OpenCollection(client, "users")
+
+		var foundUser models.User
+		err := userCollection.FindOne(ctx, bson.M{"email": req.Email, "pending_verification": true}, utils.FindUserByEmail()).Decode(&foundUser)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				c.JSON(http.StatusOK, response)
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while looking up user"})
+			return
+		}
+
+		interval := utils.VerificationResendInterval()
+		claimed, err := utils.ClaimEmailSlot(ctx, client, foundUser.UserID, "verification_sent_at", interval)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while resending verification email"})
+			return
+		}
+		if !claimed {
+			retryAfter := time.Until(foundUser.VerificationSentAt.Add(interval))
+			if retryAfter < time.Second {
+				retryAfter = time.Second
+			}
+			c.Header("Retry-After", strconv.Itoa(int(retryAfter.Round(time.Second).Seconds())))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "A verification email was sent recently, please wait before asking again"})
+			return
+		}
+
+		if err := sendVerificationEmail(ctx, foundUser); err != nil {
+			log.Printf("Error while sending verification email: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while sending verification email"})
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var verificationLink = regexp.MustCompile(`/verify-email\?token=(\S+)`)
+
+func TestEmailVerificationFlow(t *testing.T) {
+	client := testMongoClient(t)
+	useTestKeys(t)
+	outbox := useOutbox(t)
+
+	router := newTestRouter()
+	router.POST("/api/v1/register", Signup(client))
+	router.GET("/api/v1/verify-email", VerifyEmail(client))
+	router.POST("/api/v1/resend-verification", ResendVerification(client))
+
+	const email = "alice@example.com"
+
+	status, body := serveJSON(t, router, http.MethodPost, "/api/v1/register", map[string]any{
+		"first_name":          "Alice",
+		"last_name":           "Liddell",
+		"email":               email,
+		"password":            "correct horse battery",
+		"favourite_genre_ids": []string{},
+	})
+	if status != http.StatusCreated {
+		t.Fatalf("register = %d %v, want %d", status, body, http.StatusCreated)
+	}
+
+	pending := func() bool {
+		t.Helper()
+		var user models.User
+		err := database.OpenCollection(client, "users").FindOne(context.Background(), bson.M{"email": email}).Decode(&user)
+		if err != nil {
+			t.Fatalf("loading user: %v", err)
+		}
+		return user.PendingVerification
+	}
+	if !pending() {
+		t.Fatal("new account isn't pending verification")
+	}
+
+	links := outboxLinks(t, outbox, verificationLink)
+	if len(links) != 1 {
+		t.Fatalf("outbox has %d verification links after signup, want 1", len(links))
+	}
+
+	// The email was just sent, so asking again right away is throttled
+	status, body = serveJSON(t, router, http.MethodPost, "/api/v1/resend-verification", map[string]any{"email": email})
+	if status != http.StatusTooManyRequests {
+		t.Fatalf("immediate resend = %d %v, want %d", status, body, http.StatusTooManyRequests)
+	}
+	if got := len(outboxLinks(t, outbox, verificationLink)); got != 1 {
+		t.Fatalf("outbox has %d verification links after a throttled resend, want 1", got)
+	}
+
+	t.Setenv("VERIFICATION_RESEND_INTERVAL", "10ms")
+	time.Sleep(20 * time.Millisecond)
+
+	status, body = serveJSON(t, router, http.MethodPost, "/api/v1/resend-verification", map[string]any{"email": email})
+	if status != http.StatusOK {
+		t.Fatalf("resend after the interval = %d %v, want %d", status, body, http.StatusOK)
+	}
+	links = outboxLinks(t, outbox, verificationLink)
+	if len(links) != 2 {
+		t.Fatalf("outbox has %d verification links after a resend, want 2", len(links))
+	}
+
+	status, body = serveJSON(t, router, http.MethodGet, "/api/v1/verify-email?token=not-a-token", nil)
+	if status != http.StatusBadRequest {
+		t.Fatalf("verify with a bogus token = %d %v, want %d", status, body, http.StatusBadRequest)
+	}
+
+	verifyPath := "/api/v1/verify-email?token=" + url.QueryEscape(links[1])
+	status, body = serveJSON(t, router, http.MethodGet, verifyPath, nil)
+	if status != http.StatusOK {
+		t.Fatalf("verify = %d %v, want %d", status, body, http.StatusOK)
+	}
+	if pending() {
+		t.Fatal("account still pending after verification")
+	}
+
+	status, body = serveJSON(t, router, http.MethodGet, verifyPath, nil)
+	if status != http.StatusBadRequest {
+		t.Fatalf("verify with a used token = %d %v, want %d", status, body, http.StatusBadRequest)
+	}
+
+	// Verified accounts get the generic answer and no new email
+	status, body = serveJSON(t, router, http.MethodPost, "/api/v1/resend-verification", map[string]any{"email": email})
+	if status != http.StatusOK {
+		t.Fatalf("resend for a verified account = %d %v, want %d", status, body, http.StatusOK)
+	}
+	if got := len(outboxLinks(t, outbox, verificationLink)); got != 2 {
+		t.Fatalf("outbox has %d verification links after verification, want 2", got)
+	}
+}
@@ -0,0 +1,18 @@
+package controllers
+
+import (
+	"net/http"
+
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJWKS publishes the public keys that verify our access tokens so other
+// services can check them without sharing a secret.
+func GetJWKS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, utils.Keys.JWKS())
+	}
+}
@@ -0,0 +1,99 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers transactional emails such as password reset links.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultMailer Mailer = OutboxMailer{Dir: "outbox", From: "no-reply@movieapp.local"}
+)
+
+// Default returns the mailer set by main, which is rebuilt when secrets are
+// reloaded.
+func Default() Mailer {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+
+	return defaultMailer
+}
+
+func SetDefault(m Mailer) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	defaultMailer = m
+}
+
+// FromEnv picks the mailer named by MAILER: "smtp" sends through
+// SMTP_HOST/SMTP_PORT and "outbox" writes to MAILER_OUTBOX_DIR. MAILER has
+// to be set, so a deploy can't end up writing reset links to local disk.
+func FromEnv(smtpPassword string) (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@movieapp.local"
+	}
+
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, errors.New("SMTP_HOST not set in environment")
+		}
+
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+
+		return SMTPMailer{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: smtpPassword,
+			From:     from,
+		}, nil
+	case "outbox":
+		dir := os.Getenv("MAILER_OUTBOX_DIR")
+		if dir == "" {
+			dir = "outbox"
+		}
+		return OutboxMailer{Dir: dir, From: from}, nil
+	case "":
+		return nil, errors.New("MAILER not set in environment, use smtp or outbox")
+	default:
+		return nil, fmt.Errorf("unknown MAILER %q, use smtp or outbox", os.Getenv("MAILER"))
+	}
+}
+
+// render builds an RFC 5322 message shared by every mailer.
+func render(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(msg.Body)
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
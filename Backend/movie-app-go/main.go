@@ -9,7 +9,10 @@ import (
 
 	"movie-app-go/database"
 	_ "movie-app-go/docs"
+	"movie-app-go/mailer"
 	"movie-app-go/routes"
+	"movie-app-go/secrets"
+	"movie-app-go/utils"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -42,6 +45,44 @@ func main() {
 		log.Fatal("Error loading .env file")
 	}
 
+	secrets.Default.Register(secrets.Spec{Name: "SMTP_PASSWORD", Optional: true})
+	secrets.Default.SetProviders(secrets.ProvidersFromEnv()...)
+	if err := secrets.Default.Load(); err != nil {
+		log.Fatalf("Could not load secrets: %v", err)
+	}
+
+	// Services holding a secret are rebuilt after each SIGHUP reload
+	reloadHooks := []func() error{configureMailer, utils.ReloadOIDCClient}
+
+	if os.Getenv("JWT_SIGNING_KEYS_DIR") != "" {
+		if err := utils.ReloadSigningKeys(); err != nil {
+			log.Fatalf("Could not load JWT signing keys: %v", err)
+		}
+		reloadHooks = append(reloadHooks, utils.ReloadSigningKeys)
+	} else {
+		// Tokens signed with an ephemeral key die with the process and can't be
+		// checked by other replicas, so it has to be asked for explicitly
+		if os.Getenv("JWT_EPHEMERAL_KEY") != "true" {
+			log.Fatal("JWT_SIGNING_KEYS_DIR not set; set JWT_EPHEMERAL_KEY=true to sign with a throwaway key in development")
+		}
+
+		signingKey, err := utils.NewEphemeralSigningKey()
+		if err != nil {
+			log.Fatalf("Could not generate JWT signing key: %v", err)
+		}
+		utils.Keys.Replace(signingKey, []*utils.SigningKey{signingKey})
+		log.Println("JWT_EPHEMERAL_KEY set, signing with an ephemeral key; tokens won't survive a restart")
+	}
+
+	if err := configureMailer(); err != nil {
+		log.Fatalf("Could not configure mailer: %v", err)
+	}
+	if outbox, ok := mailer.Default().(mailer.OutboxMailer); ok {
+		log.Printf("MAILER=outbox, emails are written to %s instead of being sent", outbox.Dir)
+	}
+
+	secrets.ReloadOnSIGHUP(secrets.Default, reloadHooks...)
+
 	allowedOrigins := os.Getenv("ALLOWED_ORIGINS")
 
 	var origins []string
@@ -59,12 +100,23 @@ func main() {
 	corsConfig := cors.Config{
 		AllowOrigins:     origins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", utils.CSRFHeader},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}
 
+	// Client IPs drive login lockouts, so X-Forwarded-For is only honoured from known proxies
+	var trustedProxies []string
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		for _, proxy := range strings.Split(proxies, ",") {
+			trustedProxies = append(trustedProxies, strings.TrimSpace(proxy))
+		}
+	}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	router.Use(cors.New(corsConfig))
 	router.Use(gin.Logger())
 
@@ -78,6 +130,58 @@ func main() {
 	}
 	log.Println("Connected to MongoDB successfully")
 
+	if err := utils.EnsureTokenFamilyIndexes(client); err != nil {
+		log.Fatalf("Could not create token family indexes: %v", err)
+	}
+
+	if err := utils.EnsurePasswordResetIndexes(client); err != nil {
+		log.Fatalf("Could not create password reset indexes: %v", err)
+	}
+
+	if err := utils.EnsureLoginAttemptIndexes(client); err != nil {
+		log.Fatalf("Could not create login attempt indexes: %v", err)
+	}
+
+	if err := utils.EnsureOIDCLoginStateIndexes(client); err != nil {
+		log.Fatalf("Could not create OIDC login state indexes: %v", err)
+	}
+
+	if err := utils.EnsureAPIKeyIndexes(client); err != nil {
+		log.Fatalf("Could not create API key indexes: %v", err)
+	}
+
+	if err := utils.EnsureGuestIndexes(client); err != nil {
+		log.Fatalf("Could not create guest indexes: %v", err)
+	}
+
+	if err := utils.EnsureAuditEventIndexes(client); err != nil {
+		log.Fatalf("Could not create audit event indexes: %v", err)
+	}
+
+	if err := utils.EnsureAccountDeletionIndexes(client); err != nil {
+		log.Fatalf("Could not create account deletion indexes: %v", err)
+	}
+
+	if err := utils.EnsureMovieIndexes(client); err != nil {
+		log.Fatalf("Could not create movie indexes: %v", err)
+	}
+
+	if err := utils.MigrateFavouriteGenres(client); err != nil {
+		log.Fatalf("Could not migrate favourite genres: %v", err)
+	}
+
+	switch os.Getenv("TOKEN_REVOCATION_STORE") {
+	case "memory":
+		utils.Revocations = utils.NewMemoryRevocationStore()
+		log.Println("Using in-memory token revocation store")
+	default:
+		revocationStore := utils.NewMongoRevocationStore(client)
+		if err := revocationStore.EnsureIndexes(ctx); err != nil {
+			log.Fatalf("Could not create token revocation indexes: %v", err)
+		}
+		utils.Revocations = revocationStore
+	}
+
 	defer func() {
 		err := client.Disconnect(context.Background())
 		if err != nil {
@@ -85,6 +189,8 @@ func main() {
 		}
 	}()
 
+	utils.StartAccountPurger(client, utils.AccountPurgeInterval())
+
 	routes.SetupPublicRoutes(router, client)
 	routes.SetupProtectedRoutes(router, client)
 
@@ -92,3 +198,14 @@ func main() {
 		log.Fatalf("Failed to run server: %v", err)
 	}
 }
+
+// configureMailer builds the mailer from the environment with the current
+// SMTP password.
+func configureMailer() error {
+	configured, err := mailer.FromEnv(secrets.Get("SMTP_PASSWORD"))
+	if err != nil {
+		return err
+	}
+	mailer.SetDefault(configured)
+	return nil
+}
@@ -1,17 +1,25 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 
+	"movie-app-go/database"
+	"movie-app-go/models"
 	"movie-app-go/utils"
 
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 )
 
 
-func AuthenticationMiddleware() gin.HandlerFunc {
+// AuthenticationMiddleware accepts either a JWT access token or an API key.
+// API keys additionally store their scopes in the context, see RequireScope.
+func AuthenticationMiddleware(client *mongo.Client) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token, err := utils.GetAcessToken(c)
+		token, fromCookie, err := utils.GetAccessTokenWithSource(c)
 
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
@@ -25,15 +33,100 @@ func AuthenticationMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		c.Set("cookieAuth", fromCookie)
+
+		if utils.IsAPIKey(token) {
+			authenticateAPIKey(c, client, token)
+			return
+		}
+
 		claims, err := utils.ValidateToken(token)
-		if err != nil {
+		if err != nil || claims.ID == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			c.Abort()
 			return
 		}
 
+		revoked, err := utils.Revocations.IsRevoked(c.Request.Context(), claims)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while checking token"})
+			c.Abort()
+			return
+		}
+
+		// Like API keys, tokens are checked against the account on every
+		// request, so a suspension or ban also stops tokens that revocation
+		// missed, e.g. ones issued in the same second
+		if claims.Role != models.RoleGuest {
+			blocked, err := utils.AccountStatusLookup(c.Request.Context(), client, claims.UserId)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while checking token"})
+				c.Abort()
+				return
+			}
+			if blocked != nil {
+				c.JSON(http.StatusForbidden, blocked.Response())
+				c.Abort()
+				return
+			}
+		}
+
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
 		c.Set("userId", claims.UserId) // Store userId in context
 		c.Set("role", claims.Role) // Store role in context
+		c.Set("twoFactor", claims.TwoFactor)
+		c.Set("familyId", claims.FamilyId)
+		c.Set("authMethod", utils.AuthMethodJWT)
 		c.Next()
 	}
 }
+
+// authenticateAPIKey acts as the key's owner, with the owner's current role.
+func authenticateAPIKey(c *gin.Context, client *mongo.Client, key string) {
+	apiKey, err := utils.LookupAPIKey(c.Request.Context(), client, key)
+	if err != nil {
+		if errors.Is(err, utils.ErrInvalidAPIKey) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while checking API key"})
+		}
+		c.Abort()
+		return
+	}
+
+	var userCollection = database.OpenCollection(client, "users")
+
+	var owner models.User
+	err = userCollection.FindOne(
+		c.Request.Context(),
+		bson.M{"user_id": apiKey.UserID},
+		options.FindOne().SetProjection(bson.M{"user_id": 1, "role": 1, "status": 1, "status_reason": 1, "status_until": 1}),
+	).Decode(&owner)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error while checking API key"})
+		}
+		c.Abort()
+		return
+	}
+
+	if blocked := utils.CheckAccountStatus(owner.Status, owner.StatusReason, owner.StatusUntil); blocked != nil {
+		c.JSON(http.StatusForbidden, blocked.Response())
+		c.Abort()
+		return
+	}
+
+	c.Set("userId", owner.UserID)
+	c.Set("role", owner.Role)
+	c.Set("twoFactor", apiKey.TwoFactor)
+	c.Set("authMethod", utils.AuthMethodAPIKey)
+	c.Set("scopes", apiKey.Scopes)
+	c.Next()
+}
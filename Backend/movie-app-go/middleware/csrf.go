@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"net/http"
+
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireCSRF checks the X-CSRF-Token header on POST, PUT, PATCH and DELETE
+// requests authenticated with the access_token cookie. Bearer tokens and API
+// keys are never sent by the browser on its own, so they are exempt. It must
+// run after AuthenticationMiddleware.
+func RequireCSRF() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			c.Next()
+			return
+		}
+
+		if !c.GetBool("cookieAuth") {
+			c.Next()
+			return
+		}
+
+		if !utils.ValidateCSRFToken(c.GetHeader(utils.CSRFHeader), c.GetString("familyId")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Missing or invalid CSRF token"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireSessionCookieCSRF protects public endpoints that act on the session
+// cookies on their own, like refreshing and logging out. Whenever a valid
+// access_token or refresh_token cookie is sent, the X-CSRF-Token header must
+// belong to its session. Requests without cookies are left to the handler.
+func RequireSessionCookieCSRF() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var families []string
+
+		if accessToken, err := c.Cookie("access_token"); err == nil && accessToken != "" {
+			if claims, err := utils.ValidateToken(accessToken); err == nil {
+				families = append(families, claims.FamilyId)
+			}
+		}
+		if refreshToken, err := c.Cookie("refresh_token"); err == nil && refreshToken != "" {
+			if claims, err := utils.ValidateRefreshToken(refreshToken); err == nil {
+				families = append(families, claims.FamilyId)
+			}
+		}
+
+		csrfToken := c.GetHeader(utils.CSRFHeader)
+		for _, familyId := range families {
+			if !utils.ValidateCSRFToken(csrfToken, familyId) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Missing or invalid CSRF token"})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
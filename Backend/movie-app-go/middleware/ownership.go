@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"movie-app-go/models"
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OwnerResolver returns the userId of the user owning the resource addressed
+// by the request.
+type OwnerResolver func(c *gin.Context) (string, error)
+
+// OwnerFromParam resolves the owner straight from a path parameter, for
+// routes such as /updateuser/:userId.
+func OwnerFromParam(name string) OwnerResolver {
+	return func(c *gin.Context) (string, error) {
+		ownerId := c.Param(name)
+		if ownerId == "" {
+			return "", errors.New(name + " is required")
+		}
+		return ownerId, nil
+	}
+}
+
+// RequireOwnerOrAdmin lets the request through when the authenticated user
+// owns the resource or is an ADMIN. It must run after AuthenticationMiddleware.
+func RequireOwnerOrAdmin(owner OwnerResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userId, err := utils.GetuserIdFromCtx(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		role, err := utils.GetRoleFromCtx(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		if role == models.RoleAdmin {
+			c.Next()
+			return
+		}
+
+		ownerId, err := owner(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		if ownerId != userId {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole only lets requests through when AuthenticationMiddleware stored
+// the given role in the context.
+func RequireRole(role string) gin.HandlerFunc {
+	return RequireAnyRole(role)
+}
+
+// RequireAnyRole only lets requests through when the role stored by
+// AuthenticationMiddleware is one of roles. It must run after it.
+func RequireAnyRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, err := utils.GetRoleFromCtx(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+		c.Abort()
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScope lets API keys through only when they were granted scope.
+// Requests authenticated with a JWT are not limited by scopes.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes, ok := utils.GetScopesFromCtx(c)
+		if ok && !slices.Contains(scopes, scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key is missing the " + scope + " scope"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireSession refuses API keys on routes that need an interactive login,
+// such as account and key management.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("authMethod") == utils.AuthMethodAPIKey {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint can't be used with an API key"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+
+	"movie-app-go/models"
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdminTwoFactor refuses ADMIN tokens that were not obtained through a
+// 2FA login when REQUIRE_ADMIN_2FA is enabled. Admins without 2FA have to
+// enroll and log in again.
+func RequireAdminTwoFactor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !utils.AdminTwoFactorRequired() {
+			c.Next()
+			return
+		}
+
+		role, err := utils.GetRoleFromCtx(c)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			c.Abort()
+			return
+		}
+
+		if role == models.RoleAdmin && !c.GetBool("twoFactor") {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication required, enroll and log in again"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
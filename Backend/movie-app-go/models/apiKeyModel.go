@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	ScopeMoviesRead   = "movies:read"
+	ScopeMoviesWrite  = "movies:write"
+	ScopeReviewsWrite = "reviews:write"
+)
+
+// APIKey lets a service act on behalf of its owner within Scopes. Only the
+// hash of the key is stored; the key itself is returned once on creation.
+type APIKey struct {
+	ID         bson.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	KeyID      string        `json:"key_id" bson:"key_id"`
+	UserID     string        `json:"user_id" bson:"user_id"`
+	Name       string        `json:"name" bson:"name"`
+	Prefix     string        `json:"prefix" bson:"prefix"`
+	KeyHash    string        `json:"-" bson:"key_hash"`
+	Scopes     []string      `json:"scopes" bson:"scopes"`
+	TwoFactor  bool          `json:"two_factor" bson:"two_factor"`
+	CreatedAt  time.Time     `json:"created_at" bson:"created_at"`
+	LastUsedAt time.Time     `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time    `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,oneof=movies:read movies:write reviews:write"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty" validate:"omitempty,min=1,max=365"`
+}
+
+type CreateAPIKeyResponse struct {
+	Key    string `json:"key"`
+	APIKey APIKey `json:"api_key"`
+}
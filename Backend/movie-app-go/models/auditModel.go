@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	AuditActionLogin        = "auth.login"
+	AuditActionLogout       = "auth.logout"
+	AuditActionRoleChange   = "user.role_change"
+	AuditActionUserDelete   = "user.delete"
+	AuditActionUserRestore  = "user.restore"
+	AuditActionUserStatus   = "user.status_change"
+	AuditActionReviewUpdate = "movie.review_update"
+	AuditActionMovieCreate  = "movie.create"
+	AuditActionMovieUpdate  = "movie.update"
+	AuditActionMovieDelete  = "movie.delete"
+	AuditActionMovieImport  = "movie.import"
+)
+
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditEvent is one entry of the append-only security audit log. Events are
+// only ever inserted; purging an account only strips their personal details.
+type AuditEvent struct {
+	ID         bson.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	Time       time.Time      `json:"time" bson:"time"`
+	ActorID    string         `json:"actor_id,omitempty" bson:"actor_id,omitempty"`
+	ActorRole  string         `json:"actor_role,omitempty" bson:"actor_role,omitempty"`
+	Action     string         `json:"action" bson:"action"`
+	TargetType string         `json:"target_type,omitempty" bson:"target_type,omitempty"`
+	TargetID   string         `json:"target_id,omitempty" bson:"target_id,omitempty"`
+	IP         string         `json:"ip" bson:"ip"`
+	UserAgent  string         `json:"user_agent" bson:"user_agent"`
+	Outcome    string         `json:"outcome" bson:"outcome"`
+	Details    map[string]any `json:"details,omitempty" bson:"details,omitempty"`
+}
+
+type AuditEventPage struct {
+	Data  []AuditEvent `json:"data"`
+	Page  int64        `json:"page"`
+	Limit int64        `json:"limit"`
+	Total int64        `json:"total"`
+}
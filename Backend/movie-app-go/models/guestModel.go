@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Guest holds what an anonymous visitor picked so it survives an upgrade to
+// a real account. It expires together with the guest token.
+type Guest struct {
+	ID                    bson.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	GuestID               string        `json:"guest_id" bson:"guest_id"`
+	FavouriteMoviesGenres []Genre       `json:"favourite_movies_genres" bson:"favourite_movies_genres"`
+	CreatedAt             time.Time     `json:"created_at" bson:"created_at"`
+	ExpiresAt             time.Time     `json:"expires_at" bson:"expires_at"`
+}
+
+// GuestSessionCount counts the guest sessions one IP opened in a fixed
+// window. Mongo removes it once the window is over.
+type GuestSessionCount struct {
+	ID          bson.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	IP          string        `json:"ip" bson:"ip"`
+	WindowStart time.Time     `json:"window_start" bson:"window_start"`
+	Sessions    int           `json:"sessions" bson:"sessions"`
+	ExpiresAt   time.Time     `json:"expires_at" bson:"expires_at"`
+}
+
+type GuestGenresRequest struct {
+	FavouriteGenreIDs []string `json:"favourite_genre_ids" validate:"dive,required" example:"28,18"`
+}
+
+type GuestTokenResponse struct {
+	GuestID               string    `json:"guest_id"`
+	Role                  string    `json:"role"`
+	AccessToken           string    `json:"access_token"`
+	CSRFToken             string    `json:"csrf_token"`
+	ExpiresAt             time.Time `json:"expires_at"`
+	FavouriteMoviesGenres []Genre   `json:"favourite_movies_genres"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// LoginAttempt counts recent failed logins for one email address or client
+// IP. Mongo removes it once ExpiresAt has passed without new failures.
+type LoginAttempt struct {
+	ID            bson.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Key           string        `json:"key" bson:"key"`
+	Failures      int           `json:"failures" bson:"failures"`
+	LastFailureAt time.Time     `json:"last_failure_at" bson:"last_failure_at"`
+	BlockedUntil  time.Time     `json:"blocked_until,omitempty" bson:"blocked_until,omitempty"`
+	ExpiresAt     time.Time     `json:"expires_at" bson:"expires_at"`
+}
@@ -27,6 +27,21 @@ type Movie struct {
 	Description string        `bson:"description" json:"description" validate:"required,min=10,max=5000"`
 }
 
+// MoviePatch only changes the fields that are present. Each one is checked
+// against the tag of the same field in Movie. The IMDb id can't change, and the
+// review and ranking are only set through AdminReviewRequest.
+type MoviePatch struct {
+	ImdbID      *string  `json:"imdb_id,omitempty" swaggerignore:"true"`
+	Title       *string  `json:"title,omitempty"`
+	PosterURL   *string  `json:"poster_url,omitempty"`
+	YoutubeID   *string  `json:"youtube_id,omitempty"`
+	Genres      *[]Genre `json:"genres,omitempty"`
+	ReleaseYear *int     `json:"release_year,omitempty"`
+	Description *string  `json:"description,omitempty"`
+	AdminReview *string  `json:"admin_review,omitempty" swaggerignore:"true"`
+	Ranking     *Ranking `json:"ranking,omitempty" swaggerignore:"true"`
+}
+
 type AdminReviewRequest struct {
 	AdminReview string `bson:"admin_review" json:"admin_review"`
 }
@@ -35,3 +50,33 @@ type AdminReviewResponse struct {
 	RankingName string `bson:"ranking_name" json:"ranking_name"`
 	AdminReview string `bson:"admin_review" json:"admin_review"`
 }
+
+const (
+	ImportRowCreated = "created"
+	ImportRowUpdated = "updated"
+	ImportRowValid   = "valid"
+	ImportRowInvalid = "invalid"
+	ImportRowFailed  = "failed"
+)
+
+// MovieImportRow reports what happened to one row of a bulk import. Valid is
+// only used by dry runs.
+type MovieImportRow struct {
+	Row    int    `json:"row"`
+	ImdbID string `json:"imdb_id,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type MovieImportReport struct {
+	Format  string           `json:"format"`
+	DryRun  bool             `json:"dry_run"`
+	Upsert  bool             `json:"upsert"`
+	Total   int              `json:"total"`
+	Created int              `json:"created"`
+	Updated int              `json:"updated"`
+	Valid   int              `json:"valid"`
+	Failed  int              `json:"failed"`
+	Error   string           `json:"error,omitempty"`
+	Rows    []MovieImportRow `json:"rows"`
+}
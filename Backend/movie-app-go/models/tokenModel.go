@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// TokenFamily tracks the chain of refresh tokens issued from a single login,
+// which is what users see as a session on one device. Only the hash of the
+// current refresh token is kept; presenting any older token of the family
+// means it was replayed and the whole family is revoked.
+type TokenFamily struct {
+	ID              bson.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	FamilyID        string        `json:"family_id" bson:"family_id"`
+	UserID          string        `json:"user_id" bson:"user_id"`
+	TokenHash       string        `json:"-" bson:"token_hash"`
+	UserAgent       string        `json:"user_agent" bson:"user_agent"`
+	IP              string        `json:"ip" bson:"ip"`
+	Revoked         bool          `json:"revoked" bson:"revoked"`
+	CreatedAt       time.Time     `json:"created_at" bson:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at" bson:"updated_at"`
+	LastRefreshedAt time.Time     `json:"last_refreshed_at" bson:"last_refreshed_at"`
+	ExpiresAt       time.Time     `json:"expires_at" bson:"expires_at"`
+}
+
+// Session is how a token family is shown to its user. IP is the address of
+// the last login or refresh.
+type Session struct {
+	SessionID       string    `json:"session_id"`
+	UserAgent       string    `json:"user_agent"`
+	IP              string    `json:"ip"`
+	CreatedAt       time.Time `json:"created_at"`
+	LastRefreshedAt time.Time `json:"last_refreshed_at"`
+	ExpiresAt       time.Time `json:"expires_at"`
+	Current         bool      `json:"current"`
+}
+
+// RevokedToken is either a single revoked access token (JTI set), every access
+// token of one session (FamilyID set) or a cutoff revoking every access token
+// issued to a user before RevokedBefore.
+type RevokedToken struct {
+	ID            bson.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	JTI           string        `json:"jti,omitempty" bson:"jti,omitempty"`
+	FamilyID      string        `json:"family_id,omitempty" bson:"family_id,omitempty"`
+	UserID        string        `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	RevokedBefore time.Time     `json:"revoked_before,omitempty" bson:"revoked_before,omitempty"`
+	ExpiresAt     time.Time     `json:"expires_at" bson:"expires_at"`
+}
+
+// PasswordReset is a single-use reset token. Only its hash is stored.
+type PasswordReset struct {
+	ID        bson.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	TokenHash string        `json:"-" bson:"token_hash"`
+	UserID    string        `json:"user_id" bson:"user_id"`
+	Used      bool          `json:"used" bson:"used"`
+	CreatedAt time.Time     `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time     `json:"expires_at" bson:"expires_at"`
+}
+
+// OIDCLoginState remembers an authorization request until the identity
+// provider redirects back. It is deleted as soon as it is used.
+type OIDCLoginState struct {
+	ID           bson.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	StateHash    string        `json:"-" bson:"state_hash"`
+	Nonce        string        `json:"-" bson:"nonce"`
+	CodeVerifier string        `json:"-" bson:"code_verifier"`
+	CreatedAt    time.Time     `json:"created_at" bson:"created_at"`
+	ExpiresAt    time.Time     `json:"expires_at" bson:"expires_at"`
+}
@@ -7,18 +7,109 @@ import (
 )
 
 type User struct {
-	ID                    bson.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	UserID                string        `json:"user_id" bson:"user_id"`
-	FirstName             string        `json:"first_name" bson:"first_name" validate:"required"`
-	LastName              string        `json:"last_name" bson:"last_name" validate:"required"`
-	Email                 string        `json:"email" bson:"email" validate:"required,email"`
-	Password              string        `json:"password" bson:"password" validate:"required,min=8"`
-	Role                  string        `json:"role" bson:"role" validate:"oneof=ADMIN USER GUEST"`
-	CreatedAt             time.Time     `json:"created_at" bson:"created_at"`
-	UpdatedAt             time.Time     `json:"updated_at" bson:"updated_at"`
-	AccessToken           string        `json:"access_token" bson:"access_token"`
-	RefreshToken          string        `json:"refresh_token" bson:"refresh_token"`
-	FavouriteMoviesGenres []Genre       `json:"favourite_movies_genres" bson:"favourite_movies_genres" validate:"required,dive"`
+	ID                    bson.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID                string         `json:"user_id" bson:"user_id"`
+	FirstName             string         `json:"first_name" bson:"first_name" validate:"required"`
+	LastName              string         `json:"last_name" bson:"last_name" validate:"required"`
+	Email                 string         `json:"email" bson:"email" validate:"required,email"`
+	Password              string         `json:"-" bson:"password"`
+	Role                  string         `json:"role" bson:"role" validate:"oneof=ADMIN USER GUEST"`
+	CreatedAt             time.Time      `json:"created_at" bson:"created_at"`
+	UpdatedAt             time.Time      `json:"updated_at" bson:"updated_at"`
+	FavouriteMoviesGenres []Genre        `json:"favourite_movies_genres" bson:"-" validate:"required,dive"`
+	FavouriteGenreIDs     []string       `json:"-" bson:"favourite_genre_ids"`
+	PendingVerification   bool           `json:"pending_verification" bson:"pending_verification"`
+	VerificationSentAt    time.Time      `json:"verification_sent_at,omitempty" bson:"verification_sent_at,omitempty"`
+	PasswordResetSentAt   time.Time      `json:"-" bson:"password_reset_sent_at,omitempty"`
+	TOTPEnabled           bool           `json:"totp_enabled" bson:"totp_enabled"`
+	TOTPSecret            string         `json:"-" bson:"totp_secret,omitempty"`
+	TOTPPendingSecret     string         `json:"-" bson:"totp_pending_secret,omitempty"`
+	TOTPLastStep          int64          `json:"-" bson:"totp_last_step,omitempty"`
+	RecoveryCodeHashes    []string       `json:"-" bson:"recovery_code_hashes,omitempty"`
+	OIDCIdentities        []OIDCIdentity `json:"-" bson:"oidc_identities,omitempty"`
+	DeletedAt             *time.Time     `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	PurgeAt               *time.Time     `json:"purge_at,omitempty" bson:"purge_at,omitempty"`
+	Status                string         `json:"status,omitempty" bson:"status,omitempty"`
+	StatusReason          string         `json:"status_reason,omitempty" bson:"status_reason,omitempty"`
+	StatusUntil           *time.Time     `json:"status_until,omitempty" bson:"status_until,omitempty"`
+}
+
+// OIDCIdentity links an account to a subject at an OpenID Connect provider.
+type OIDCIdentity struct {
+	Issuer   string    `json:"issuer" bson:"issuer"`
+	Subject  string    `json:"subject" bson:"subject"`
+	LinkedAt time.Time `json:"linked_at" bson:"linked_at"`
+}
+
+// UserResponse is how a user is shown to themselves. Fields are listed
+// explicitly so that nothing stored next to them can end up in a response.
+type UserResponse struct {
+	UserID                string    `json:"user_id" bson:"user_id"`
+	FirstName             string    `json:"first_name" bson:"first_name"`
+	LastName              string    `json:"last_name" bson:"last_name"`
+	Email                 string    `json:"email" bson:"email"`
+	Role                  string    `json:"role" bson:"role"`
+	FavouriteMoviesGenres []Genre   `json:"favourite_movies_genres" bson:"-"`
+	FavouriteGenreIDs     []string  `json:"-" bson:"favourite_genre_ids"`
+	PendingVerification   bool      `json:"pending_verification" bson:"pending_verification"`
+	TOTPEnabled           bool      `json:"totp_enabled" bson:"totp_enabled"`
+	CreatedAt             time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt             time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// AdminUserResponse adds the account state only admins get to see.
+type AdminUserResponse struct {
+	UserResponse `bson:",inline"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	PurgeAt      *time.Time `json:"purge_at,omitempty" bson:"purge_at,omitempty"`
+	Status       string     `json:"status" bson:"status,omitempty"`
+	StatusReason string     `json:"status_reason,omitempty" bson:"status_reason,omitempty"`
+	StatusUntil  *time.Time `json:"status_until,omitempty" bson:"status_until,omitempty"`
+}
+
+type AdminUserListResponse struct {
+	Data []AdminUserResponse `json:"data"`
+}
+
+// UserDetailResponse documents GetUserByID; deleted_at and purge_at are only
+// filled in for admins.
+type UserDetailResponse struct {
+	Data AdminUserResponse `json:"data"`
+}
+
+// UserProjection and AdminUserProjection select the fields of the matching
+// view, so passwords, tokens and 2FA secrets are never read from the database.
+var UserProjection = bson.M{
+	"_id":                  0,
+	"user_id":              1,
+	"first_name":           1,
+	"last_name":            1,
+	"email":                1,
+	"role":                 1,
+	"favourite_genre_ids":  1,
+	"pending_verification": 1,
+	"totp_enabled":         1,
+	"created_at":           1,
+	"updated_at":           1,
+}
+
+var AdminUserProjection = func() bson.M {
+	projection := bson.M{"deleted_at": 1, "purge_at": 1, "status": 1, "status_reason": 1, "status_until": 1}
+	for field, include := range UserProjection {
+		projection[field] = include
+	}
+	return projection
+}()
+
+// SignupRequest is what a new user sends to register. The stored User never
+// takes its password from JSON, so a hash can't be serialized by accident.
+type SignupRequest struct {
+	FirstName         string   `json:"first_name" validate:"required"`
+	LastName          string   `json:"last_name" validate:"required"`
+	Email             string   `json:"email" validate:"required,email"`
+	Password          string   `json:"password,omitempty" validate:"required,min=8"`
+	Role              string   `json:"role,omitempty" validate:"omitempty,oneof=ADMIN USER GUEST"`
+	FavouriteGenreIDs []string `json:"favourite_genre_ids" validate:"required,dive,required" example:"28,18"`
 }
 
 type UserLogin struct {
@@ -34,18 +125,126 @@ type LoginResponse struct {
 	Role                  string  `json:"role"`
 	AccessToken           string  `json:"access_token"`
 	RefreshToken          string  `json:"refresh_token"`
+	CSRFToken             string  `json:"csrf_token"`
 	FavouriteMoviesGenres []Genre `json:"favourite_movies_genres"`
 }
 
+type CSRFTokenResponse struct {
+	CSRFToken string `json:"csrf_token"`
+}
+
 type UserLogout struct {
 	UserId string `json:"user_id"`
 }
 
+// UpdateUser only changes the fields that are present. Passwords are changed
+// through ChangePasswordRequest and roles through UpdateUserRoleRequest.
+// Favourite genres are given as genre ids.
 type UpdateUser struct {
-	FirstName             *string   `json:"first_name,omitempty" bson:"first_name,omitempty"`
-	LastName              *string   `json:"last_name,omitempty" bson:"last_name,omitempty"`
-	Email                 *string   `json:"email,omitempty" bson:"email,omitempty"`
-	Password              *string   `json:"password,omitempty" bson:"password,omitempty"`
-	Role                  *string   `json:"role,omitempty" bson:"role,omitempty"`
-	FavouriteMoviesGenres *[]string `json:"favourite_movies_genres,omitempty" bson:"favourite_movies_genres,omitempty"`
+	FirstName         *string   `json:"first_name,omitempty" bson:"first_name,omitempty" validate:"omitnil,min=1"`
+	LastName          *string   `json:"last_name,omitempty" bson:"last_name,omitempty" validate:"omitnil,min=1"`
+	Email             *string   `json:"email,omitempty" bson:"email,omitempty" validate:"omitnil,email"`
+	Password          *string   `json:"password,omitempty" bson:"password,omitempty" swaggerignore:"true"`
+	Role              *string   `json:"role,omitempty" bson:"role,omitempty" swaggerignore:"true"`
+	FavouriteGenreIDs *[]string `json:"favourite_genre_ids,omitempty" bson:"-" validate:"omitnil,dive,required" example:"28,18"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required,min=8,nefield=CurrentPassword"`
+}
+
+const (
+	RoleAdmin = "ADMIN"
+	RoleUser  = "USER"
+	RoleGuest = "GUEST"
+)
+
+// An account without a status is active. Suspensions and bans may carry an
+// expiry after which the account is active again.
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusBanned    = "banned"
+)
+
+// UpdateUserStatusRequest and UpdateUserRoleRequest are admin actions; the
+// reason is kept in the audit log.
+type UpdateUserStatusRequest struct {
+	Status string     `json:"status" validate:"required,oneof=active suspended banned"`
+	Reason string     `json:"reason" validate:"required,min=3,max=500"`
+	Until  *time.Time `json:"until,omitempty" validate:"omitnil"`
+}
+
+type UpdateUserRoleRequest struct {
+	Role   string `json:"role" validate:"required,oneof=ADMIN USER"`
+	Reason string `json:"reason" validate:"required,min=3,max=500"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type DeleteUserResponse struct {
+	Message string    `json:"message"`
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+type RestoreAccountRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+// UserDataExport is everything stored about a user, as handed out by the
+// personal data export. Secrets and hashes are left out.
+type UserDataExport struct {
+	ExportedAt            time.Time      `json:"exported_at"`
+	UserID                string         `json:"user_id"`
+	FirstName             string         `json:"first_name"`
+	LastName              string         `json:"last_name"`
+	Email                 string         `json:"email"`
+	Role                  string         `json:"role"`
+	CreatedAt             time.Time      `json:"created_at"`
+	UpdatedAt             time.Time      `json:"updated_at"`
+	PendingVerification   bool           `json:"pending_verification"`
+	TOTPEnabled           bool           `json:"totp_enabled"`
+	FavouriteMoviesGenres []Genre        `json:"favourite_movies_genres"`
+	OIDCIdentities        []OIDCIdentity `json:"oidc_identities"`
+	Sessions              []Session      `json:"sessions"`
+	APIKeys               []APIKey       `json:"api_keys"`
+	AuditEvents           []AuditEvent   `json:"audit_events"`
+}
+
+type TwoFactorChallengeResponse struct {
+	MfaRequired bool   `json:"mfa_required"`
+	MfaToken    string `json:"mfa_token"`
+}
+
+type TwoFactorLoginRequest struct {
+	MfaToken     string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code         string `json:"code" validate:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type TwoFactorEnrollResponse struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+type TwoFactorConfirmResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
 }
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// secretFields must never be serialized in a user view. totp_enabled is the
+// only totp_ field that may be shown.
+var secretFields = []string{
+	"password",
+	"access_token",
+	"refresh_token",
+	"totp_secret",
+	"totp_pending_secret",
+	"totp_last_step",
+	"recovery_code_hashes",
+	"password_reset_sent_at",
+	"key_hash",
+	"token_hash",
+}
+
+func isSecretField(name string) bool {
+	if strings.HasPrefix(name, "totp_") && name != "totp_enabled" {
+		return true
+	}
+	for _, secret := range secretFields {
+		if name == secret {
+			return true
+		}
+	}
+	return false
+}
+
+// fill sets every field reachable from v to a non-zero value, so omitempty
+// can't hide a field that would leak once it holds data.
+func fill(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString("x")
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Pointer:
+		v.Set(reflect.New(v.Type().Elem()))
+		fill(v.Elem())
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 1, 1))
+		fill(v.Index(0))
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		v.SetMapIndex(reflect.ValueOf("x").Convert(v.Type().Key()), reflect.Zero(v.Type().Elem()))
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(time.Time{}) {
+			v.Set(reflect.ValueOf(time.Now()))
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				fill(v.Field(i))
+			}
+		}
+	}
+}
+
+// jsonKeys collects the object keys at any depth of a decoded JSON value.
+func jsonKeys(value any, keys map[string]bool) {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, nested := range value {
+			keys[key] = true
+			jsonKeys(nested, keys)
+		}
+	case []any:
+		for _, nested := range value {
+			jsonKeys(nested, keys)
+		}
+	}
+}
+
+func TestUserViewsHideSecrets(t *testing.T) {
+	tests := []struct {
+		name string
+		view any
+		// allowed lists secret fields the view exists to hand out
+		allowed []string
+	}{
+		{name: "User", view: &User{}},
+		{name: "UserResponse", view: &UserResponse{}},
+		{name: "AdminUserResponse", view: &AdminUserResponse{}},
+		{name: "UserDataExport", view: &UserDataExport{}},
+		{name: "AdminUserListResponse", view: &AdminUserListResponse{}},
+		{name: "UserDetailResponse", view: &UserDetailResponse{}},
+		{name: "Session", view: &Session{}},
+		{name: "TokenFamily", view: &TokenFamily{}},
+		{name: "APIKey", view: &APIKey{}},
+		// The raw key is shown once under "key", the stored hash never
+		{name: "CreateAPIKeyResponse", view: &CreateAPIKeyResponse{}},
+		// The login and guest responses carry the new session's tokens, never stored ones
+		{name: "LoginResponse", view: &LoginResponse{}, allowed: []string{"access_token", "refresh_token"}},
+		{name: "GuestTokenResponse", view: &GuestTokenResponse{}, allowed: []string{"access_token"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fill(reflect.ValueOf(tt.view).Elem())
+
+			body, err := json.Marshal(tt.view)
+			if err != nil {
+				t.Fatalf("marshalling: %v", err)
+			}
+			var decoded any
+			if err := json.Unmarshal(body, &decoded); err != nil {
+				t.Fatalf("unmarshalling: %v", err)
+			}
+
+			keys := map[string]bool{}
+			jsonKeys(decoded, keys)
+			for _, allowed := range tt.allowed {
+				delete(keys, allowed)
+			}
+
+			for key := range keys {
+				if isSecretField(key) {
+					t.Errorf("%s serializes %q: %s", tt.name, key, body)
+				}
+			}
+		})
+	}
+}
+
+func TestUserProjectionsOnlySelectPublicFields(t *testing.T) {
+	projections := map[string]map[string]any{
+		"UserProjection":      UserProjection,
+		"AdminUserProjection": AdminUserProjection,
+	}
+
+	for name, projection := range projections {
+		t.Run(name, func(t *testing.T) {
+			for field, include := range projection {
+				// An exclusion would turn the projection into "everything but",
+				// which lets any new secret field through
+				if field != "_id" && include != 1 {
+					t.Errorf("%s has %q: %v, want only inclusions", name, field, include)
+				}
+				if isSecretField(field) {
+					t.Errorf("%s selects %q", name, field)
+				}
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package routes
 import (
 	conntroller "movie-app-go/controllers"
 	"movie-app-go/middleware"
+	"movie-app-go/models"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/v2/mongo"
@@ -10,19 +11,84 @@ import (
 
 func SetupProtectedRoutes(router *gin.Engine, client *mongo.Client) {
 	protectedRoutes := router.Group("/api/v1")
-	protectedRoutes.Use(middleware.AuthenticationMiddleware())
+	protectedRoutes.Use(middleware.AuthenticationMiddleware(client), middleware.RequireCSRF())
+
+	protectedRoutes.GET("/csrf-token", conntroller.GetCSRFToken())
+
+	// Read-only catalog, open to every authenticated role and movies:read keys
+	guestRoutes := protectedRoutes.Group("")
+	guestRoutes.Use(middleware.RequireAnyRole(models.RoleGuest, models.RoleUser, models.RoleAdmin), middleware.RequireScope(models.ScopeMoviesRead))
+	{
+		guestRoutes.GET("/movies", conntroller.GetMovies(client))
+		guestRoutes.GET("/movie/:imdbId", conntroller.GetMovieByID(client))
+		guestRoutes.GET("/genres", conntroller.GetGenres(client))
+	}
+
+	// Anonymous guests only
+	guestOnlyRoutes := protectedRoutes.Group("")
+	guestOnlyRoutes.Use(middleware.RequireRole(models.RoleGuest), middleware.RequireSession())
+	{
+		guestOnlyRoutes.PUT("/guest/genres", conntroller.UpdateGuestGenres(client))
+	}
+
+	// Registered accounts; per-user resources are limited to their owner or an admin
+	userRoutes := protectedRoutes.Group("")
+	userRoutes.Use(middleware.RequireAnyRole(models.RoleUser, models.RoleAdmin), middleware.RequireSession())
+	ownerOrAdmin := middleware.RequireOwnerOrAdmin(middleware.OwnerFromParam("userId"))
+	{
+		userRoutes.GET("/getuserbyID/:userId", ownerOrAdmin, conntroller.GetUserByID(client))
+		userRoutes.PUT("/updateuser/:userId", ownerOrAdmin, conntroller.UpdateUser(client))
+		userRoutes.DELETE("/deleteuser/:userId", ownerOrAdmin, conntroller.DeleteUser(client))
+		userRoutes.GET("/me/export", conntroller.ExportUserData(client))
+		userRoutes.GET("/recommendatedmovies", conntroller.GetMovieRecommendations(client))
+		userRoutes.GET("/recommendations-ai", conntroller.GetRecommendationFromAI(client))
+		userRoutes.GET("/searchmovies", conntroller.SearchMovies(client))
+		userRoutes.POST("/change-password", conntroller.ChangePassword(client))
+		userRoutes.GET("/sessions", conntroller.GetSessions(client))
+		userRoutes.DELETE("/sessions", conntroller.RevokeOtherSessions(client))
+		userRoutes.DELETE("/sessions/:sessionId", conntroller.RevokeSession(client))
+		userRoutes.POST("/2fa/enroll", conntroller.EnrollTwoFactor(client))
+		userRoutes.POST("/2fa/confirm", conntroller.ConfirmTwoFactor(client))
+		userRoutes.POST("/2fa/disable", conntroller.DisableTwoFactor(client))
+		userRoutes.POST("/api-keys", conntroller.CreateAPIKey(client))
+		userRoutes.GET("/api-keys", conntroller.GetAPIKeys(client))
+		userRoutes.DELETE("/api-keys/:keyId", conntroller.DeleteAPIKey(client))
+	}
+
+	setupAdminRoutes(protectedRoutes, client)
+	setupCatalogAdminRoutes(protectedRoutes, client)
+}
+
+// setupAdminRoutes registers the administration routes. Every route added
+// here is checked by the USER token test in protectedRoutes_test.go.
+func setupAdminRoutes(protectedRoutes *gin.RouterGroup, client *mongo.Client) {
+	adminRoutes := protectedRoutes.Group("")
+	adminRoutes.Use(middleware.RequireRole(models.RoleAdmin), middleware.RequireAdminTwoFactor(), middleware.RequireSession())
+	{
+		adminRoutes.GET("/users", conntroller.GetUsers(client))
+		adminRoutes.POST("/users/:userId/restore", conntroller.RestoreUser(client))
+		adminRoutes.PUT("/users/:userId/status", conntroller.UpdateUserStatus(client))
+		adminRoutes.PUT("/users/:userId/role", conntroller.UpdateUserRole(client))
+		adminRoutes.GET("/users/:userId/sessions", conntroller.GetUserSessions(client))
+		adminRoutes.DELETE("/users/:userId/sessions", conntroller.RevokeAllUserSessions(client))
+		adminRoutes.DELETE("/users/:userId/sessions/:sessionId", conntroller.RevokeUserSession(client))
+		adminRoutes.DELETE("/lockout", conntroller.ClearLockout(client))
+		adminRoutes.GET("/audit-events", conntroller.GetAuditEvents(client))
+		adminRoutes.GET("/audit-events/export", conntroller.ExportAuditEvents(client))
+	}
+}
+
+// setupCatalogAdminRoutes registers catalog administration, which is also
+// open to admin API keys with a write scope.
+func setupCatalogAdminRoutes(protectedRoutes *gin.RouterGroup, client *mongo.Client) {
+	catalogAdminRoutes := protectedRoutes.Group("")
+	catalogAdminRoutes.Use(middleware.RequireRole(models.RoleAdmin), middleware.RequireAdminTwoFactor())
 	{
-		protectedRoutes.GET("/getuserbyID/:userId", conntroller.GetUserByID(client))
-		protectedRoutes.PUT("/updateuser/:userId", conntroller.UpdateUser(client))
-		protectedRoutes.DELETE("/deleteuser/:userId", conntroller.DeleteUser(client))
-		protectedRoutes.GET("/users", conntroller.GetUsers(client))
-		protectedRoutes.POST("/addmovie", conntroller.AddMovie(client))
-		protectedRoutes.GET("/movies", conntroller.GetMovies(client))
-		protectedRoutes.GET("/movie/:imdbId", conntroller.GetMovieByID(client))
-		protectedRoutes.PATCH("/movie/review/:imdbId", conntroller.UpdateAdminReview(client))
-		protectedRoutes.GET("/recommendatedmovies", conntroller.GetMovieRecommendations(client))
-		protectedRoutes.GET("/recommendations-ai", conntroller.GetRecommendationFromAI(client))
-		protectedRoutes.GET("/searchmovies", conntroller.SearchMovies(client))
-		protectedRoutes.GET("/genres", conntroller.GetGenres(client))
+		catalogAdminRoutes.POST("/addmovie", middleware.RequireScope(models.ScopeMoviesWrite), conntroller.AddMovie(client))
+		catalogAdminRoutes.POST("/movies/import", middleware.RequireScope(models.ScopeMoviesWrite), conntroller.ImportMovies(client))
+		catalogAdminRoutes.PUT("/movie/:imdbId", middleware.RequireScope(models.ScopeMoviesWrite), conntroller.ReplaceMovie(client))
+		catalogAdminRoutes.PATCH("/movie/:imdbId", middleware.RequireScope(models.ScopeMoviesWrite), conntroller.PatchMovie(client))
+		catalogAdminRoutes.DELETE("/movie/:imdbId", middleware.RequireScope(models.ScopeMoviesWrite), conntroller.DeleteMovie(client))
+		catalogAdminRoutes.PATCH("/movie/review/:imdbId", middleware.RequireScope(models.ScopeReviewsWrite), conntroller.UpdateAdminReview(client))
 	}
 }
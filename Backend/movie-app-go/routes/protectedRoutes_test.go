@@ -0,0 +1,212 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"movie-app-go/models"
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// adminRouteList lists the routes registered by the admin groups. Building it
+// from the router means a new admin route is covered without touching the test.
+func adminRouteList(t *testing.T) []gin.RouteInfo {
+	t.Helper()
+
+	router := gin.New()
+	group := router.Group("/api/v1")
+	setupAdminRoutes(group, nil)
+	setupCatalogAdminRoutes(group, nil)
+
+	routes := router.Routes()
+	if len(routes) == 0 {
+		t.Fatal("no admin routes registered")
+	}
+	return routes
+}
+
+// concretePath fills in path parameters so the route matches.
+func concretePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "test-" + segment[1:]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// stubAccountStatus answers every account status lookup with blocked, so
+// AuthenticationMiddleware runs without a database.
+func stubAccountStatus(t *testing.T, blocked *utils.AccountStatusError) {
+	t.Helper()
+
+	previous := utils.AccountStatusLookup
+	utils.AccountStatusLookup = func(context.Context, *mongo.Client, string) (*utils.AccountStatusError, error) {
+		return blocked, nil
+	}
+	t.Cleanup(func() { utils.AccountStatusLookup = previous })
+}
+
+func signedToken(t *testing.T, key *utils.SigningKey, role string) string {
+	t.Helper()
+
+	claims := &utils.SigninDetails{
+		Email:     "user@example.com",
+		FirstName: "Test",
+		LastName:  "User",
+		Role:      role,
+		UserId:    bson.NewObjectID().Hex(),
+		FamilyId:  utils.NewTokenFamilyID(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        bson.NewObjectID().Hex(),
+			Issuer:    "movie-app-go",
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.Kid
+	signed, err := token.SignedString(key.Private)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return signed
+}
+
+func TestAdminRoutesRefuseNonAdminTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	key, err := utils.NewEphemeralSigningKey()
+	if err != nil {
+		t.Fatalf("generating signing key: %v", err)
+	}
+	previousActive, _ := utils.Keys.Active()
+	previousKeys := utils.Keys.All()
+	utils.Keys.Replace(key, []*utils.SigningKey{key})
+	t.Cleanup(func() { utils.Keys.Replace(previousActive, previousKeys) })
+
+	previousRevocations := utils.Revocations
+	utils.Revocations = utils.NewMemoryRevocationStore()
+	t.Cleanup(func() { utils.Revocations = previousRevocations })
+
+	stubAccountStatus(t, nil)
+
+	// A handler reached by mistake opens a collection on the nil client; give
+	// it an .env to read so that shows up as a 500 instead of exiting
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("MONGO_DB_NAME=test\n"), 0o600); err != nil {
+		t.Fatalf("writing .env: %v", err)
+	}
+	t.Chdir(dir)
+
+	// The full router, so the test goes through the same middleware as main.
+	// Requests must be refused before any handler touches the database.
+	router := gin.New()
+	router.Use(gin.Recovery())
+	SetupProtectedRoutes(router, nil)
+
+	tests := []struct {
+		name string
+		role string
+	}{
+		{name: "user", role: models.RoleUser},
+		{name: "guest", role: models.RoleGuest},
+	}
+
+	adminRoutes := adminRouteList(t)
+
+	for _, tt := range tests {
+		token := signedToken(t, key, tt.role)
+
+		for _, route := range adminRoutes {
+			t.Run(tt.name+" "+route.Method+" "+route.Path, func(t *testing.T) {
+				req := httptest.NewRequest(route.Method, concretePath(route.Path), strings.NewReader("{}"))
+				req.Header.Set("Authorization", "Bearer "+token)
+				req.Header.Set("Content-Type", "application/json")
+
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+
+				if rec.Code != http.StatusForbidden {
+					t.Fatalf("status = %d, want %d; body %s", rec.Code, http.StatusForbidden, rec.Body.String())
+				}
+
+				var body struct {
+					Error string `json:"error"`
+				}
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Error != "Forbidden" {
+					t.Fatalf("body = %s, want the role check's Forbidden error", rec.Body.String())
+				}
+			})
+		}
+	}
+}
+
+func TestJWTRequestsCheckTheAccountStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	key, err := utils.NewEphemeralSigningKey()
+	if err != nil {
+		t.Fatalf("generating signing key: %v", err)
+	}
+	previousActive, _ := utils.Keys.Active()
+	previousKeys := utils.Keys.All()
+	utils.Keys.Replace(key, []*utils.SigningKey{key})
+	t.Cleanup(func() { utils.Keys.Replace(previousActive, previousKeys) })
+
+	previousRevocations := utils.Revocations
+	utils.Revocations = utils.NewMemoryRevocationStore()
+	t.Cleanup(func() { utils.Revocations = previousRevocations })
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+	SetupProtectedRoutes(router, nil)
+
+	get := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/csrf-token", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	token := signedToken(t, key, models.RoleUser)
+
+	stubAccountStatus(t, nil)
+	if rec := get(token); rec.Code != http.StatusOK {
+		t.Fatalf("active account: status = %d, want %d; body %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	// Suspending revokes the user's tokens, but one issued in the same second
+	// as the cutoff is not revoked; the status check still turns it away
+	stubAccountStatus(t, utils.CheckAccountStatus(models.UserStatusSuspended, "spam", nil))
+	rec := get(token)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("suspended account: status = %d, want %d; body %s", rec.Code, http.StatusForbidden, rec.Body.String())
+	}
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Code != utils.ErrCodeAccountSuspended {
+		t.Fatalf("body = %s, want the account_suspended code", rec.Body.String())
+	}
+
+	// Guests have no account to look up
+	if rec := get(signedToken(t, key, models.RoleGuest)); rec.Code != http.StatusOK {
+		t.Fatalf("guest: status = %d, want %d; body %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+}
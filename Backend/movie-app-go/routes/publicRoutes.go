@@ -2,17 +2,29 @@ package routes
 
 import (
 	conntroller "movie-app-go/controllers"
+	"movie-app-go/middleware"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 func SetupPublicRoutes(router *gin.Engine, client *mongo.Client) {
+	router.GET("/.well-known/jwks.json", conntroller.GetJWKS())
+
 	publicRoutes := router.Group("/api/v1")
 	{
 		publicRoutes.POST("/register", conntroller.Signup(client))
 		publicRoutes.POST("/login", conntroller.Login(client))
-		publicRoutes.POST("/refresh-token", conntroller.RefreshToken(client))
-		publicRoutes.POST("/logout", conntroller.Logout(client))
+		publicRoutes.POST("/guest", conntroller.CreateGuestSession(client))
+		publicRoutes.POST("/login/2fa", conntroller.LoginTwoFactor(client))
+		publicRoutes.POST("/refresh-token", middleware.RequireSessionCookieCSRF(), conntroller.RefreshToken(client))
+		publicRoutes.POST("/logout", middleware.RequireSessionCookieCSRF(), conntroller.Logout(client))
+		publicRoutes.POST("/forgot-password", conntroller.ForgotPassword(client))
+		publicRoutes.POST("/reset-password", conntroller.ResetPassword(client))
+		publicRoutes.GET("/verify-email", conntroller.VerifyEmail(client))
+		publicRoutes.POST("/resend-verification", conntroller.ResendVerification(client))
+		publicRoutes.POST("/restore-account", conntroller.RestoreAccount(client))
+		publicRoutes.GET("/oidc/login", conntroller.OIDCLogin(client))
+		publicRoutes.GET("/oidc/callback", conntroller.OIDCCallback(client))
 	}
 }
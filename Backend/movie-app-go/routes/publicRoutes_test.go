@@ -0,0 +1,112 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"movie-app-go/middleware"
+	"movie-app-go/secrets"
+	"movie-app-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSessionCookieRoutesRequireCSRF(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	key, err := utils.NewEphemeralSigningKey()
+	if err != nil {
+		t.Fatalf("generating signing key: %v", err)
+	}
+	previousActive, _ := utils.Keys.Active()
+	previousKeys := utils.Keys.All()
+	utils.Keys.Replace(key, []*utils.SigningKey{key})
+	t.Cleanup(func() { utils.Keys.Replace(previousActive, previousKeys) })
+
+	t.Setenv(utils.JWT_REFRESH_SECRET_KEY, "t3st-R3fr3sh-k3y-9f2Lq8Zr1Tx7Vb4Nm6Wc")
+	if err := secrets.Default.Load(); err != nil {
+		t.Fatalf("loading secrets: %v", err)
+	}
+
+	// As in TestAdminRoutesRefuseNonAdminTokens, a handler reached by mistake
+	// fails on the nil client instead of exiting
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), []byte("MONGO_DB_NAME=test\n"), 0o600); err != nil {
+		t.Fatalf("writing .env: %v", err)
+	}
+	t.Chdir(dir)
+
+	familyId := utils.NewTokenFamilyID()
+	accessToken, refreshToken, err := utils.GenerateAllTokens("user-1", "Test", "User", "user@example.com", "USER", familyId, false)
+	if err != nil {
+		t.Fatalf("generating tokens: %v", err)
+	}
+	csrfToken, err := utils.GenerateCSRFToken(familyId)
+	if err != nil {
+		t.Fatalf("generating CSRF token: %v", err)
+	}
+	otherCSRFToken, err := utils.GenerateCSRFToken(utils.NewTokenFamilyID())
+	if err != nil {
+		t.Fatalf("generating CSRF token: %v", err)
+	}
+
+	router := gin.New()
+	router.Use(gin.Recovery())
+	SetupPublicRoutes(router, nil)
+
+	// Same middleware in front of a stub, to see requests it lets through
+	passed := gin.New()
+	passed.POST("/", middleware.RequireSessionCookieCSRF(), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		name    string
+		cookies map[string]string
+		csrf    string
+		refused bool
+	}{
+		{name: "refresh cookie without header", cookies: map[string]string{"refresh_token": refreshToken}, refused: true},
+		{name: "refresh cookie with another session's header", cookies: map[string]string{"refresh_token": refreshToken}, csrf: otherCSRFToken, refused: true},
+		{name: "access cookie without header", cookies: map[string]string{"access_token": accessToken}, refused: true},
+		{name: "both cookies with a malformed header", cookies: map[string]string{"access_token": accessToken, "refresh_token": refreshToken}, csrf: "garbage", refused: true},
+		{name: "refresh cookie with its header", cookies: map[string]string{"refresh_token": refreshToken}, csrf: csrfToken},
+		{name: "both cookies with their header", cookies: map[string]string{"access_token": accessToken, "refresh_token": refreshToken}, csrf: csrfToken},
+		{name: "no cookies", cookies: map[string]string{}},
+	}
+
+	request := func(path string, cookies map[string]string, csrf string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		for name, value := range cookies {
+			req.AddCookie(&http.Cookie{Name: name, Value: value})
+		}
+		if csrf != "" {
+			req.Header.Set(utils.CSRFHeader, csrf)
+		}
+		return req
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.refused {
+				for _, path := range []string{"/api/v1/refresh-token", "/api/v1/logout"} {
+					rec := httptest.NewRecorder()
+					router.ServeHTTP(rec, request(path, tt.cookies, tt.csrf))
+					if rec.Code != http.StatusForbidden {
+						t.Errorf("%s status = %d, want %d; body %s", path, rec.Code, http.StatusForbidden, rec.Body.String())
+					}
+				}
+				return
+			}
+
+			rec := httptest.NewRecorder()
+			passed.ServeHTTP(rec, request("/", tt.cookies, tt.csrf))
+			if rec.Code != http.StatusNoContent {
+				t.Errorf("status = %d, want the request let through; body %s", rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package secrets
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Provider looks a secret up by name. found is false when the provider has no
+// value for it, so the next provider in the chain is asked.
+type Provider interface {
+	Name() string
+	Lookup(name string) (value string, found bool, err error)
+}
+
+// EnvProvider reads secrets from plain environment variables.
+type EnvProvider struct{}
+
+func (EnvProvider) Name() string { return "env" }
+
+func (EnvProvider) Lookup(name string) (string, bool, error) {
+	value, ok := os.LookupEnv(name)
+	return value, ok, nil
+}
+
+// FileProvider follows the <NAME>_FILE convention used by Docker and
+// Kubernetes secrets: the variable holds the path of a file with the secret.
+type FileProvider struct{}
+
+func (FileProvider) Name() string { return "file" }
+
+func (FileProvider) Lookup(name string) (string, bool, error) {
+	path, ok := os.LookupEnv(name + "_FILE")
+	if !ok || path == "" {
+		return "", false, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, err
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+// DirProvider reads the file named after the secret from a mounted
+// directory, such as /run/secrets or a Kubernetes secret volume.
+type DirProvider struct {
+	Dir string
+}
+
+func (p DirProvider) Name() string { return "dir:" + p.Dir }
+
+func (p DirProvider) Lookup(name string) (string, bool, error) {
+	data, err := os.ReadFile(filepath.Join(p.Dir, name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+// ProvidersFromEnv returns the default chain: <NAME>_FILE first, then the
+// SECRETS_DIR directory when set, then plain environment variables.
+func ProvidersFromEnv() []Provider {
+	providers := []Provider{FileProvider{}}
+
+	if dir := os.Getenv("SECRETS_DIR"); dir != "" {
+		providers = append(providers, DirProvider{Dir: dir})
+	}
+
+	return append(providers, EnvProvider{})
+}
@@ -0,0 +1,49 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Reload loads the store again, then runs each hook. A failed load leaves the
+// previous values in place and skips the hooks; a failed hook doesn't stop
+// the ones after it.
+func Reload(store *Store, hooks ...func() error) error {
+	if err := store.Load(); err != nil {
+		return fmt.Errorf("keeping previous secrets: %w", err)
+	}
+
+	var hookErrors []error
+	for _, hook := range hooks {
+		if err := hook(); err != nil {
+			hookErrors = append(hookErrors, err)
+		}
+	}
+	if len(hookErrors) > 0 {
+		return fmt.Errorf("reload hook failed: %w", errors.Join(hookErrors...))
+	}
+
+	return nil
+}
+
+// ReloadOnSIGHUP runs Reload every time the process receives SIGHUP.
+// Failures are logged.
+func ReloadOnSIGHUP(store *Store, hooks ...func() error) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		for range signals {
+			if err := Reload(store, hooks...); err != nil {
+				log.Printf("Secret reload failed: %v", err)
+				continue
+			}
+
+			log.Println("Secrets reloaded")
+		}
+	}()
+}
@@ -0,0 +1,115 @@
+package secrets
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Spec describes a secret the application needs and how strong it must be.
+// Secrets with a MinLength are keys we generate, and are also checked for
+// placeholders and variety. Without one the secret is a credential issued by
+// a third party and only has to be set.
+type Spec struct {
+	Name      string
+	MinLength int
+	Optional  bool
+}
+
+// Store resolves secrets through a chain of providers. Values are only
+// swapped in once every required secret loaded and passed validation, so a
+// bad reload leaves the previous values in place.
+type Store struct {
+	mu        sync.RWMutex
+	providers []Provider
+	specs     []Spec
+	values    map[string]string
+}
+
+func NewStore(providers ...Provider) *Store {
+	return &Store{providers: providers, values: map[string]string{}}
+}
+
+// Default is the store the rest of the application reads from. main
+// configures its providers and loads it at startup.
+var Default = NewStore(EnvProvider{})
+
+func (s *Store) SetProviders(providers ...Provider) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.providers = providers
+}
+
+func (s *Store) Register(specs ...Spec) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.specs = append(s.specs, specs...)
+}
+
+func (s *Store) Load() error {
+	s.mu.RLock()
+	providers := s.providers
+	specs := s.specs
+	s.mu.RUnlock()
+
+	values := make(map[string]string, len(specs))
+	var problems []string
+
+	for _, spec := range specs {
+		value, source, err := lookup(providers, spec.Name)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", spec.Name, err))
+			continue
+		}
+
+		if value == "" && spec.Optional {
+			continue
+		}
+
+		if err := validate(spec, value); err != nil {
+			if source != "" {
+				err = fmt.Errorf("%w (from %s)", err, source)
+			}
+			problems = append(problems, fmt.Sprintf("%s: %v", spec.Name, err))
+			continue
+		}
+
+		values[spec.Name] = value
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid secrets: %s", strings.Join(problems, "; "))
+	}
+
+	s.mu.Lock()
+	s.values = values
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *Store) Get(name string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.values[name]
+}
+
+func Get(name string) string {
+	return Default.Get(name)
+}
+
+func lookup(providers []Provider, name string) (string, string, error) {
+	for _, provider := range providers {
+		value, found, err := provider.Lookup(name)
+		if err != nil {
+			return "", provider.Name(), err
+		}
+		if found {
+			return value, provider.Name(), nil
+		}
+	}
+	return "", "", nil
+}
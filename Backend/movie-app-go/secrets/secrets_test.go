@@ -0,0 +1,214 @@
+package secrets
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const (
+	strongFromFile = "f1LeK3y-9f2Lq8Zr1Tx7Vb4Nm6Wc0Hs5Jd"
+	strongFromDir  = "d1RK3y-9f2Lq8Zr1Tx7Vb4Nm6Wc0Hs5Jd2"
+	strongFromEnv  = "eNvK3y-9f2Lq8Zr1Tx7Vb4Nm6Wc0Hs5Jd2"
+)
+
+func writeSecret(t *testing.T, path, value string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(value+"\n"), 0o600); err != nil {
+		t.Fatalf("writing %s: %v", path, err)
+	}
+}
+
+func TestProvidersFromEnvOrder(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(t.TempDir(), "jwt_refresh")
+
+	writeSecret(t, file, strongFromFile)
+	writeSecret(t, filepath.Join(dir, "JWT_REFRESH_SECRET_KEY"), strongFromDir)
+	t.Setenv("JWT_REFRESH_SECRET_KEY_FILE", file)
+	t.Setenv("SECRETS_DIR", dir)
+	t.Setenv("JWT_REFRESH_SECRET_KEY", strongFromEnv)
+
+	load := func() string {
+		t.Helper()
+		store := NewStore(ProvidersFromEnv()...)
+		store.Register(Spec{Name: "JWT_REFRESH_SECRET_KEY", MinLength: 32})
+		if err := store.Load(); err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		return store.Get("JWT_REFRESH_SECRET_KEY")
+	}
+
+	if got := load(); got != strongFromFile {
+		t.Fatalf("with every source set got %q, want the <NAME>_FILE value", got)
+	}
+
+	t.Setenv("JWT_REFRESH_SECRET_KEY_FILE", "")
+	if got := load(); got != strongFromDir {
+		t.Fatalf("without <NAME>_FILE got %q, want the SECRETS_DIR value", got)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "JWT_REFRESH_SECRET_KEY")); err != nil {
+		t.Fatalf("removing secret file: %v", err)
+	}
+	if got := load(); got != strongFromEnv {
+		t.Fatalf("without files got %q, want the environment value", got)
+	}
+}
+
+func TestFileProviderReportsUnreadableFiles(t *testing.T) {
+	t.Setenv("SMTP_PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+	t.Setenv("SMTP_PASSWORD", "from-env")
+
+	store := NewStore(ProvidersFromEnv()...)
+	store.Register(Spec{Name: "SMTP_PASSWORD", Optional: true})
+
+	// A mount that went missing must not silently fall back to the environment
+	err := store.Load()
+	if err == nil || !strings.Contains(err.Error(), "SMTP_PASSWORD") {
+		t.Fatalf("Load error = %v, want one naming SMTP_PASSWORD", err)
+	}
+}
+
+func TestLoadValidatesSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    Spec
+		value   *string
+		wantErr string
+		want    string
+	}{
+		{name: "strong key", spec: Spec{Name: "KEY", MinLength: 32}, value: ptr(strongFromEnv), want: strongFromEnv},
+		{name: "missing required key", spec: Spec{Name: "KEY", MinLength: 32}, wantErr: "is empty"},
+		{name: "blank required key", spec: Spec{Name: "KEY", MinLength: 32}, value: ptr("   "), wantErr: "is empty"},
+		{name: "short key", spec: Spec{Name: "KEY", MinLength: 32}, value: ptr("k3Y-9f2Lq8Zr1Tx7"), wantErr: "at least 32 characters"},
+		{name: "placeholder key", spec: Spec{Name: "KEY", MinLength: 32}, value: ptr("please-ChangeMe-before-going-live-1234"), wantErr: "placeholder"},
+		{name: "repetitive key", spec: Spec{Name: "KEY", MinLength: 32}, value: ptr(strings.Repeat("ab12", 10)), wantErr: "too few distinct"},
+		{name: "missing optional credential", spec: Spec{Name: "CREDENTIAL", Optional: true}},
+		{name: "empty optional credential", spec: Spec{Name: "CREDENTIAL", Optional: true}, value: ptr("")},
+		{name: "third-party credential is only checked for being set", spec: Spec{Name: "CREDENTIAL", Optional: true}, value: ptr("password1"), want: "password1"},
+		{name: "blank optional credential", spec: Spec{Name: "CREDENTIAL", Optional: true}, value: ptr(" "), wantErr: "is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := mapProvider{}
+			if tt.value != nil {
+				values[tt.spec.Name] = *tt.value
+			}
+
+			store := NewStore(values)
+			store.Register(tt.spec)
+
+			err := store.Load()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if got := store.Get(tt.spec.Name); got != tt.want {
+				t.Fatalf("Get = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFailedLoadKeepsPreviousValues(t *testing.T) {
+	values := mapProvider{"KEY": strongFromEnv}
+	store := NewStore(values)
+	store.Register(Spec{Name: "KEY", MinLength: 32})
+	if err := store.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	values["KEY"] = "changeme"
+	if err := store.Load(); err == nil {
+		t.Fatal("Load accepted a placeholder")
+	}
+	if got := store.Get("KEY"); got != strongFromEnv {
+		t.Fatalf("Get after a failed load = %q, want the previous value", got)
+	}
+}
+
+func TestReload(t *testing.T) {
+	values := mapProvider{"KEY": strongFromEnv}
+	store := NewStore(values)
+	store.Register(Spec{Name: "KEY", MinLength: 32})
+	if err := store.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	var ran []string
+	hook := func(name string, err error) func() error {
+		return func() error {
+			ran = append(ran, name)
+			return err
+		}
+	}
+	broken := errors.New("mailer is down")
+
+	values["KEY"] = strongFromFile
+	err := Reload(store, hook("first", broken), hook("second", nil))
+	if !errors.Is(err, broken) {
+		t.Fatalf("Reload error = %v, want the hook's error", err)
+	}
+	if strings.Join(ran, ",") != "first,second" {
+		t.Fatalf("hooks ran = %v, want both despite the first failing", ran)
+	}
+	if got := store.Get("KEY"); got != strongFromFile {
+		t.Fatalf("Get = %q, want the reloaded value", got)
+	}
+
+	ran = nil
+	values["KEY"] = "short"
+	if err := Reload(store, hook("first", nil)); err == nil {
+		t.Fatal("Reload accepted an invalid secret")
+	}
+	if len(ran) != 0 {
+		t.Fatalf("hooks ran = %v after a failed load, want none", ran)
+	}
+	if got := store.Get("KEY"); got != strongFromFile {
+		t.Fatalf("Get after a failed reload = %q, want the previous value", got)
+	}
+}
+
+func TestReloadOnSIGHUP(t *testing.T) {
+	store := NewStore(mapProvider{})
+	reloaded := make(chan struct{}, 1)
+
+	ReloadOnSIGHUP(store, func() error {
+		reloaded <- struct{}{}
+		return nil
+	})
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("sending SIGHUP: %v", err)
+	}
+
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("hooks didn't run after SIGHUP")
+	}
+}
+
+type mapProvider map[string]string
+
+func (mapProvider) Name() string { return "map" }
+
+func (p mapProvider) Lookup(name string) (string, bool, error) {
+	value, ok := p[name]
+	return value, ok, nil
+}
+
+func ptr(value string) *string {
+	return &value
+}
@@ -0,0 +1,53 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// placeholders are values copied from examples that must never reach
+// production.
+var placeholders = []string{
+	"secret",
+	"changeme",
+	"change_me",
+	"password",
+	"your_secret_key",
+	"your-secret-key",
+	"jwt_secret",
+	"default",
+}
+
+func validate(spec Spec, value string) error {
+	if strings.TrimSpace(value) == "" {
+		return errors.New("is empty")
+	}
+
+	// Credentials issued by someone else, such as SMTP passwords, are not
+	// ours to choose, and a real one may well contain "password"
+	if spec.MinLength == 0 {
+		return nil
+	}
+
+	if len(value) < spec.MinLength {
+		return fmt.Errorf("must be at least %d characters, got %d", spec.MinLength, len(value))
+	}
+
+	lower := strings.ToLower(value)
+	for _, placeholder := range placeholders {
+		if strings.Contains(lower, placeholder) {
+			return fmt.Errorf("looks like a placeholder (%q)", placeholder)
+		}
+	}
+
+	distinct := map[rune]struct{}{}
+	for _, r := range value {
+		distinct[r] = struct{}{}
+	}
+	if len(distinct) < 8 {
+		return errors.New("has too few distinct characters")
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// AccountDeletionGracePeriod is how long a deleted account can still be
+// restored before it is purged. Set with ACCOUNT_DELETION_GRACE_PERIOD.
+func AccountDeletionGracePeriod() time.Duration {
+	if period, err := time.ParseDuration(os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD")); err == nil && period >= 0 {
+		return period
+	}
+	return 30 * 24 * time.Hour
+}
+
+// AccountPurgeInterval is how often StartAccountPurger looks for accounts
+// whose grace period is over. Set with ACCOUNT_PURGE_INTERVAL.
+func AccountPurgeInterval() time.Duration {
+	if interval, err := time.ParseDuration(os.Getenv("ACCOUNT_PURGE_INTERVAL")); err == nil && interval > 0 {
+		return interval
+	}
+	return time.Hour
+}
+
+// PurgeAccount removes everything stored about a user. Audit events are kept
+// for accountability but lose the personal details they carried.
+func PurgeAccount(ctx context.Context, client *mongo.Client, user models.User) error {
+	byUser := bson.M{"user_id": user.UserID}
+
+	for _, name := range []string{"token_families", "api_keys", "password_resets"} {
+		if _, err := database.OpenCollection(client, name).DeleteMany(ctx, byUser); err != nil {
+			return err
+		}
+	}
+
+	var attemptCollection *mongo.Collection = database.OpenCollection(client, "login_attempts")
+	_, err := attemptCollection.DeleteMany(ctx, bson.M{"key": bson.M{"$in": bson.A{
+		EmailThrottleKey(user.Email).Key,
+		TwoFactorThrottleKey(user.UserID).Key,
+	}}})
+	if err != nil {
+		return err
+	}
+
+	var auditCollection *mongo.Collection = database.OpenCollection(client, "audit_events")
+	_, err = auditCollection.UpdateMany(
+		ctx,
+		bson.M{"$or": bson.A{bson.M{"actor_id": user.UserID}, bson.M{"target_id": user.UserID}}},
+		bson.M{"$unset": bson.M{"ip": "", "user_agent": "", "details.email": ""}},
+	)
+	if err != nil {
+		return err
+	}
+
+	// Matching deleted_at keeps an account restored in the meantime
+	var userCollection *mongo.Collection = database.OpenCollection(client, "users")
+	_, err = userCollection.DeleteOne(ctx, bson.M{"user_id": user.UserID, "deleted_at": bson.M{"$exists": true}})
+	return err
+}
+
+// PurgeDeletedAccounts purges every account whose grace period is over and
+// returns how many were purged.
+func PurgeDeletedAccounts(ctx context.Context, client *mongo.Client) (int, error) {
+	var userCollection *mongo.Collection = database.OpenCollection(client, "users")
+
+	cursor, err := userCollection.Find(
+		ctx,
+		bson.M{"purge_at": bson.M{"$lte": time.Now()}},
+		options.Find().SetProjection(bson.M{"user_id": 1, "email": 1}),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	purged := 0
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return purged, err
+		}
+		if err := PurgeAccount(ctx, client, user); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, cursor.Err()
+}
+
+// StartAccountPurger runs PurgeDeletedAccounts in the background every
+// interval for the lifetime of the process.
+func StartAccountPurger(client *mongo.Client, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			purged, err := PurgeDeletedAccounts(ctx, client)
+			cancel()
+
+			if err != nil {
+				log.Printf("Account purge failed: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d deleted accounts", purged)
+			}
+
+			<-ticker.C
+		}
+	}()
+}
+
+func EnsureAccountDeletionIndexes(client *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var userCollection *mongo.Collection = database.OpenCollection(client, "users")
+	_, err := userCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "purge_at", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	})
+	return err
+}
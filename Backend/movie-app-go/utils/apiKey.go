@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// APIKeyPrefix marks a credential as an API key rather than a JWT, so both
+// can be sent in the same Authorization header.
+const APIKeyPrefix = "mak_"
+
+// Values of the "authMethod" context key set by AuthenticationMiddleware.
+const (
+	AuthMethodJWT    = "jwt"
+	AuthMethodAPIKey = "api_key"
+)
+
+// apiKeyTouchInterval limits how often last_used_at is written for busy keys.
+const apiKeyTouchInterval = time.Minute
+
+var ErrInvalidAPIKey = errors.New("invalid or expired API key")
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// NewAPIKey returns a fresh key and the hash that is stored for it.
+func NewAPIKey() (string, string, error) {
+	secret, err := NewOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	key := APIKeyPrefix + secret
+	return key, HashToken(key), nil
+}
+
+// LookupAPIKey returns the stored key matching key and records that it was
+// used.
+func LookupAPIKey(ctx context.Context, client *mongo.Client, key string) (*models.APIKey, error) {
+	var keyCollection *mongo.Collection = database.OpenCollection(client, "api_keys")
+
+	var apiKey models.APIKey
+	err := keyCollection.FindOne(ctx, bson.M{
+		"key_hash": HashToken(key),
+		"$or": bson.A{
+			bson.M{"expires_at": bson.M{"$exists": false}},
+			bson.M{"expires_at": bson.M{"$gt": time.Now()}},
+		},
+	}).Decode(&apiKey)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if now.Sub(apiKey.LastUsedAt) > apiKeyTouchInterval {
+		_, err = keyCollection.UpdateOne(ctx, bson.M{"key_id": apiKey.KeyID}, bson.M{"$set": bson.M{"last_used_at": now}})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &apiKey, nil
+}
+
+// DeleteUserAPIKeys revokes every API key owned by a user.
+func DeleteUserAPIKeys(ctx context.Context, userId string, client *mongo.Client) error {
+	var keyCollection *mongo.Collection = database.OpenCollection(client, "api_keys")
+
+	_, err := keyCollection.DeleteMany(ctx, bson.M{"user_id": userId})
+	return err
+}
+
+func EnsureAPIKeyIndexes(client *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var keyCollection *mongo.Collection = database.OpenCollection(client, "api_keys")
+	_, err := keyCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "key_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "key_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+		{
+			// Keys without an expiry have no expires_at and are never removed
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
+
+// GetScopesFromCtx returns the scopes of the API key that authenticated the
+// request. ok is false when the request was authenticated with a JWT, which
+// carries every permission of its user.
+func GetScopesFromCtx(c *gin.Context) (scopes []string, ok bool) {
+	value, exists := c.Get("scopes")
+	if !exists {
+		return nil, false
+	}
+
+	scopes, ok = value.([]string)
+	return scopes, ok
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// RecordAuditEvent appends event to the audit_events collection. The time,
+// client IP, user agent and, unless already set, the authenticated actor are
+// taken from the request. A failed write is logged rather than failing the
+// request it describes.
+func RecordAuditEvent(c *gin.Context, client *mongo.Client, event models.AuditEvent) {
+	event.Time = time.Now()
+	event.IP = c.ClientIP()
+	event.UserAgent = c.Request.UserAgent()
+	if len(event.UserAgent) > maxUserAgentLength {
+		event.UserAgent = event.UserAgent[:maxUserAgentLength]
+	}
+
+	if event.ActorID == "" {
+		event.ActorID = c.GetString("userId")
+		event.ActorRole = c.GetString("role")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var auditCollection *mongo.Collection = database.OpenCollection(client, "audit_events")
+	if _, err := auditCollection.InsertOne(ctx, event); err != nil {
+		log.Printf("Error while recording audit event %s: %v", event.Action, err)
+	}
+}
+
+func EnsureAuditEventIndexes(client *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var auditCollection *mongo.Collection = database.OpenCollection(client, "audit_events")
+	_, err := auditCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "target_id", Value: 1}, {Key: "time", Value: -1}}},
+	})
+	return err
+}
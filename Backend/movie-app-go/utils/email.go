@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// EmailCollation compares email addresses case-insensitively. Every lookup
+// and uniqueness check on users.email uses it, so addresses that only differ
+// in case belong to the same account.
+var EmailCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// FindUserByEmail returns the options for looking a user up by email. The
+// oldest account wins if signups ever differed only in case.
+func FindUserByEmail() *options.FindOneOptionsBuilder {
+	return options.FindOne().
+		SetCollation(EmailCollation).
+		SetSort(bson.D{{Key: "created_at", Value: 1}})
+}
@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// UnknownGenresError lists genre ids that are not in the genres collection.
+type UnknownGenresError struct {
+	IDs []string
+}
+
+func (e *UnknownGenresError) Error() string {
+	return "Unknown genre IDs: " + strings.Join(e.IDs, ", ")
+}
+
+// GenreIDs returns the ids of genres in order, without duplicates.
+func GenreIDs(genres []models.Genre) []string {
+	seen := map[string]bool{}
+	ids := []string{}
+	for _, genre := range genres {
+		if seen[genre.GenreID] {
+			continue
+		}
+		seen[genre.GenreID] = true
+		ids = append(ids, genre.GenreID)
+	}
+	return ids
+}
+
+// GenresByID loads the genres with the given ids, keyed by id.
+func GenresByID(ctx context.Context, client *mongo.Client, ids []string) (map[string]models.Genre, error) {
+	genres := map[string]models.Genre{}
+	if len(ids) == 0 {
+		return genres, nil
+	}
+
+	var genreCollection *mongo.Collection = database.OpenCollection(client, "genres")
+
+	cursor, err := genreCollection.Find(ctx, bson.M{"genre_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var genre models.Genre
+		if err := cursor.Decode(&genre); err != nil {
+			return nil, err
+		}
+		genres[genre.GenreID] = genre
+	}
+
+	return genres, cursor.Err()
+}
+
+// ResolveGenres turns stored genre references back into genres, in order.
+// References to genres that have since been removed are skipped.
+func ResolveGenres(ctx context.Context, client *mongo.Client, ids []string) ([]models.Genre, error) {
+	byID, err := GenresByID(ctx, client, ids)
+	if err != nil {
+		return nil, err
+	}
+	return pickGenres(byID, ids), nil
+}
+
+// ValidateGenreIDs checks ids against the genres collection before they are
+// stored. It returns the matching genres, or an *UnknownGenresError naming
+// the ids that don't exist.
+func ValidateGenreIDs(ctx context.Context, client *mongo.Client, ids []string) ([]models.Genre, error) {
+	byID, err := GenresByID(ctx, client, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	unknown := []string{}
+	for _, id := range ids {
+		if _, ok := byID[id]; !ok {
+			unknown = append(unknown, id)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, &UnknownGenresError{IDs: unknown}
+	}
+
+	return pickGenres(byID, ids), nil
+}
+
+func pickGenres(byID map[string]models.Genre, ids []string) []models.Genre {
+	genres := []models.Genre{}
+	for _, id := range ids {
+		if genre, ok := byID[id]; ok {
+			genres = append(genres, genre)
+		}
+	}
+	return genres
+}
+
+// MigrateFavouriteGenres rewrites users that still embed whole genres, or the
+// plain strings older updates wrote, into favourite_genre_ids references.
+func MigrateFavouriteGenres(client *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	var userCollection *mongo.Collection = database.OpenCollection(client, "users")
+	_, err := userCollection.UpdateMany(
+		ctx,
+		bson.M{"favourite_movies_genres": bson.M{"$exists": true}},
+		mongo.Pipeline{
+			{{Key: "$set", Value: bson.M{"favourite_genre_ids": bson.M{"$map": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$favourite_movies_genres", bson.A{}}},
+				"as":    "genre",
+				"in": bson.M{"$cond": bson.A{
+					bson.M{"$eq": bson.A{bson.M{"$type": "$$genre"}, "string"}},
+					"$$genre",
+					"$$genre.genre_id",
+				}},
+			}}}}},
+			{{Key: "$unset", Value: "favourite_movies_genres"}},
+		},
+	)
+	return err
+}
@@ -0,0 +1,188 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// GuestTokenTTL is short because guest tokens can't be refreshed; a guest
+// simply asks for a new one.
+const GuestTokenTTL = time.Hour
+
+// Each IP can open GuestSessionLimit guest sessions per GuestSessionWindow.
+// Windows are fixed, so the count starts over on the hour.
+const (
+	GuestSessionLimit  = 20
+	GuestSessionWindow = time.Hour
+)
+
+var ErrGuestNotFound = errors.New("guest session not found or expired")
+
+// GenerateGuestToken issues an access token for an anonymous GUEST. The guest
+// id doubles as the session id so CSRF tokens and revocation work as they do
+// for logins.
+func GenerateGuestToken(guestId string, expiresAt time.Time) (string, error) {
+	now := time.Now()
+
+	claims := &SigninDetails{
+		Role:     models.RoleGuest,
+		UserId:   guestId,
+		FamilyId: guestId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        bson.NewObjectID().Hex(),
+			Issuer:    "movie-app-go",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	return signAccessToken(claims)
+}
+
+func CreateGuest(ctx context.Context, client *mongo.Client, genres []models.Genre) (models.Guest, error) {
+	now := time.Now()
+
+	if genres == nil {
+		genres = []models.Genre{}
+	}
+
+	guest := models.Guest{
+		GuestID:               NewTokenFamilyID(),
+		FavouriteMoviesGenres: genres,
+		CreatedAt:             now,
+		ExpiresAt:             now.Add(GuestTokenTTL),
+	}
+
+	var guestCollection *mongo.Collection = database.OpenCollection(client, "guests")
+	_, err := guestCollection.InsertOne(ctx, guest)
+	return guest, err
+}
+
+func GetGuest(ctx context.Context, client *mongo.Client, guestId string) (models.Guest, error) {
+	var guestCollection *mongo.Collection = database.OpenCollection(client, "guests")
+
+	var guest models.Guest
+	err := guestCollection.FindOne(ctx, bson.M{"guest_id": guestId, "expires_at": bson.M{"$gt": time.Now()}}).Decode(&guest)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return guest, ErrGuestNotFound
+	}
+	return guest, err
+}
+
+func SetGuestGenres(ctx context.Context, client *mongo.Client, guestId string, genres []models.Genre) error {
+	var guestCollection *mongo.Collection = database.OpenCollection(client, "guests")
+
+	result, err := guestCollection.UpdateOne(
+		ctx,
+		bson.M{"guest_id": guestId, "expires_at": bson.M{"$gt": time.Now()}},
+		bson.M{"$set": bson.M{"favourite_movies_genres": genres}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrGuestNotFound
+	}
+	return nil
+}
+
+func DeleteGuest(ctx context.Context, client *mongo.Client, guestId string) error {
+	var guestCollection *mongo.Collection = database.OpenCollection(client, "guests")
+
+	_, err := guestCollection.DeleteOne(ctx, bson.M{"guest_id": guestId})
+	return err
+}
+
+// GuestSessionsBlockedFor returns how long the IP must wait before opening
+// another guest session, zero when it is under the limit.
+func GuestSessionsBlockedFor(ctx context.Context, client *mongo.Client, ip string) (time.Duration, error) {
+	now := time.Now()
+	windowStart := now.Truncate(GuestSessionWindow)
+
+	var countCollection *mongo.Collection = database.OpenCollection(client, "guest_session_counts")
+
+	var count models.GuestSessionCount
+	err := countCollection.FindOne(ctx, bson.M{"ip": ip, "window_start": windowStart}).Decode(&count)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if count.Sessions < GuestSessionLimit {
+		return 0, nil
+	}
+	return windowStart.Add(GuestSessionWindow).Sub(now), nil
+}
+
+// RecordGuestSession counts a guest session opened by the IP in the current
+// window.
+func RecordGuestSession(ctx context.Context, client *mongo.Client, ip string) error {
+	windowStart := time.Now().Truncate(GuestSessionWindow)
+
+	var countCollection *mongo.Collection = database.OpenCollection(client, "guest_session_counts")
+	_, err := countCollection.UpdateOne(
+		ctx,
+		bson.M{"ip": ip, "window_start": windowStart},
+		bson.M{
+			"$inc": bson.M{"sessions": 1},
+			"$set": bson.M{"expires_at": windowStart.Add(GuestSessionWindow)},
+		},
+		options.UpdateOne().SetUpsert(true),
+	)
+	return err
+}
+
+// ResetGuestSessions lets the IP open guest sessions again straight away.
+func ResetGuestSessions(ctx context.Context, client *mongo.Client, ip string) (int64, error) {
+	var countCollection *mongo.Collection = database.OpenCollection(client, "guest_session_counts")
+
+	result, err := countCollection.DeleteMany(ctx, bson.M{"ip": ip})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func EnsureGuestIndexes(client *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var guestCollection *mongo.Collection = database.OpenCollection(client, "guests")
+	_, err := guestCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "guest_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	var countCollection *mongo.Collection = database.OpenCollection(client, "guest_session_counts")
+	_, err = countCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "ip", Value: 1}, {Key: "window_start", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
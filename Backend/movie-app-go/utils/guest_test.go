@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGuestSessionLimit(t *testing.T) {
+	client := testMongoClient(t)
+	if err := EnsureGuestIndexes(client); err != nil {
+		t.Fatalf("creating indexes: %v", err)
+	}
+
+	ctx := context.Background()
+	const ip = "203.0.113.7"
+
+	for i := 0; i < GuestSessionLimit; i++ {
+		wait, err := GuestSessionsBlockedFor(ctx, client, ip)
+		if err != nil {
+			t.Fatalf("GuestSessionsBlockedFor: %v", err)
+		}
+		if wait != 0 {
+			t.Fatalf("blocked for %v after %d sessions, limit is %d", wait, i, GuestSessionLimit)
+		}
+		if err := RecordGuestSession(ctx, client, ip); err != nil {
+			t.Fatalf("RecordGuestSession: %v", err)
+		}
+	}
+
+	wait, err := GuestSessionsBlockedFor(ctx, client, ip)
+	if err != nil {
+		t.Fatalf("GuestSessionsBlockedFor: %v", err)
+	}
+	if wait <= 0 || wait > GuestSessionWindow {
+		t.Fatalf("blocked for %v at the limit, want until the window ends", wait)
+	}
+
+	// Other addresses and failed logins from this one aren't affected
+	if wait, _ := GuestSessionsBlockedFor(ctx, client, "203.0.113.8"); wait != 0 {
+		t.Fatalf("another address is blocked for %v", wait)
+	}
+	if wait, _ := LoginBlockedFor(ctx, client, IPThrottleKey(ip)); wait != 0 {
+		t.Fatalf("guest sessions blocked logins from the address for %v", wait)
+	}
+
+	cleared, err := ResetGuestSessions(ctx, client, ip)
+	if err != nil {
+		t.Fatalf("ResetGuestSessions: %v", err)
+	}
+	if cleared != 1 {
+		t.Fatalf("ResetGuestSessions cleared %d windows, want 1", cleared)
+	}
+	if wait, _ := GuestSessionsBlockedFor(ctx, client, ip); wait != 0 {
+		t.Fatalf("still blocked for %v after a reset", wait)
+	}
+}
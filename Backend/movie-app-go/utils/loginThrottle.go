@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// ThrottlePolicy describes how failed logins slow down further attempts:
+// after FreeAttempts every failure doubles the wait starting at BaseDelay,
+// and after LockoutAfter failures the key is locked for LockoutDuration.
+// Counters are forgotten Window after the last failure.
+type ThrottlePolicy struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	Window          time.Duration
+}
+
+var EmailThrottlePolicy = ThrottlePolicy{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAfter:    10,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+// IPThrottlePolicy is looser since many users can share an address.
+var IPThrottlePolicy = ThrottlePolicy{
+	FreeAttempts:    20,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAfter:    100,
+	LockoutDuration: time.Hour,
+	Window:          time.Hour,
+}
+
+type ThrottleKey struct {
+	Key    string
+	Policy ThrottlePolicy
+}
+
+func EmailThrottleKey(email string) ThrottleKey {
+	return ThrottleKey{Key: "email:" + strings.ToLower(strings.TrimSpace(email)), Policy: EmailThrottlePolicy}
+}
+
+func IPThrottleKey(ip string) ThrottleKey {
+	return ThrottleKey{Key: "ip:" + ip, Policy: IPThrottlePolicy}
+}
+
+// TwoFactorThrottleKey protects the second login step of one account.
+func TwoFactorThrottleKey(userId string) ThrottleKey {
+	return ThrottleKey{Key: "2fa:" + userId, Policy: EmailThrottlePolicy}
+}
+
+func (p ThrottlePolicy) blockFor(failures int) time.Duration {
+	if failures >= p.LockoutAfter {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+// LoginBlockedFor returns how long the caller must wait before trying again,
+// zero when none of the keys is blocked.
+func LoginBlockedFor(ctx context.Context, client *mongo.Client, keys ...ThrottleKey) (time.Duration, error) {
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, key.Key)
+	}
+
+	var attemptCollection *mongo.Collection = database.OpenCollection(client, "login_attempts")
+	cursor, err := attemptCollection.Find(ctx, bson.M{"key": bson.M{"$in": names}, "blocked_until": bson.M{"$gt": time.Now()}})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var attempts []models.LoginAttempt
+	if err := cursor.All(ctx, &attempts); err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	for _, attempt := range attempts {
+		if remaining := time.Until(attempt.BlockedUntil); remaining > wait {
+			wait = remaining
+		}
+	}
+	return wait, nil
+}
+
+// RecordLoginFailure counts a failed attempt against every key and blocks
+// the ones that went over their policy.
+func RecordLoginFailure(ctx context.Context, client *mongo.Client, keys ...ThrottleKey) error {
+	var attemptCollection *mongo.Collection = database.OpenCollection(client, "login_attempts")
+
+	for _, key := range keys {
+		now := time.Now()
+
+		var attempt models.LoginAttempt
+		err := attemptCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"key": key.Key},
+			bson.M{
+				"$inc": bson.M{"failures": 1},
+				"$set": bson.M{"last_failure_at": now, "expires_at": now.Add(key.Policy.Window)},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&attempt)
+		if err != nil {
+			return err
+		}
+
+		block := key.Policy.blockFor(attempt.Failures)
+		if block == 0 {
+			continue
+		}
+
+		blockedUntil := now.Add(block)
+		expiresAt := now.Add(key.Policy.Window)
+		if blockedUntil.After(expiresAt) {
+			expiresAt = blockedUntil
+		}
+
+		_, err = attemptCollection.UpdateOne(ctx, bson.M{"key": key.Key}, bson.M{
+			"$max": bson.M{"blocked_until": blockedUntil, "expires_at": expiresAt},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ResetLoginFailures clears the counters of the given keys, after a
+// successful login or when an admin lifts a lockout.
+func ResetLoginFailures(ctx context.Context, client *mongo.Client, keys ...ThrottleKey) (int64, error) {
+	if len(keys) == 0 {
+		return 0, errors.New("no lockout key given")
+	}
+
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, key.Key)
+	}
+
+	var attemptCollection *mongo.Collection = database.OpenCollection(client, "login_attempts")
+	result, err := attemptCollection.DeleteMany(ctx, bson.M{"key": bson.M{"$in": names}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func EnsureLoginAttemptIndexes(client *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var attemptCollection *mongo.Collection = database.OpenCollection(client, "login_attempts")
+	_, err := attemptCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "key", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestThrottlePolicyBlockFor(t *testing.T) {
+	policy := ThrottlePolicy{
+		FreeAttempts:    3,
+		BaseDelay:       time.Second,
+		MaxDelay:        10 * time.Second,
+		LockoutAfter:    10,
+		LockoutDuration: 15 * time.Minute,
+		Window:          time.Hour,
+	}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{failures: 0, want: 0},
+		{failures: 1, want: 0},
+		{failures: 3, want: 0},
+		{failures: 4, want: time.Second},
+		{failures: 5, want: 2 * time.Second},
+		{failures: 6, want: 4 * time.Second},
+		{failures: 7, want: 8 * time.Second},
+		{failures: 8, want: 10 * time.Second},
+		{failures: 9, want: 10 * time.Second},
+		{failures: 10, want: 15 * time.Minute},
+		{failures: 500, want: 15 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := policy.blockFor(tt.failures); got != tt.want {
+			t.Errorf("blockFor(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestThrottlePoliciesLockOutAfterTheirFreeAttempts(t *testing.T) {
+	policies := map[string]ThrottlePolicy{
+		"email": EmailThrottlePolicy,
+		"ip":    IPThrottlePolicy,
+	}
+
+	for name, policy := range policies {
+		t.Run(name, func(t *testing.T) {
+			if got := policy.blockFor(policy.FreeAttempts); got != 0 {
+				t.Errorf("blockFor(FreeAttempts) = %v, want no delay", got)
+			}
+			if got := policy.blockFor(policy.FreeAttempts + 1); got != policy.BaseDelay {
+				t.Errorf("blockFor(FreeAttempts+1) = %v, want BaseDelay", got)
+			}
+
+			// The delay never decreases and stays capped until the lockout
+			previous := time.Duration(0)
+			for failures := 1; failures < policy.LockoutAfter; failures++ {
+				got := policy.blockFor(failures)
+				if got < previous || got > policy.MaxDelay {
+					t.Fatalf("blockFor(%d) = %v after %v, want a non-decreasing delay up to %v", failures, got, previous, policy.MaxDelay)
+				}
+				previous = got
+			}
+
+			if got := policy.blockFor(policy.LockoutAfter); got != policy.LockoutDuration {
+				t.Errorf("blockFor(LockoutAfter) = %v, want LockoutDuration", got)
+			}
+		})
+	}
+}
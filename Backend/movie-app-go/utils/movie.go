@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"movie-app-go/database"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// EnsureMovieIndexes makes imdb_id unique. Catalogs that already hold
+// duplicates are reported by id, since the index can't be built until they
+// are cleaned up.
+func EnsureMovieIndexes(client *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var movieCollection *mongo.Collection = database.OpenCollection(client, "movies")
+
+	cursor, err := movieCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$imdb_id", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$limit", Value: 20}},
+	})
+	if err != nil {
+		return err
+	}
+
+	var duplicates []struct {
+		ImdbID string `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		ids := make([]string, 0, len(duplicates))
+		for _, duplicate := range duplicates {
+			ids = append(ids, duplicate.ImdbID)
+		}
+		return fmt.Errorf("movies share an imdb_id, remove the extra copies first: %s", strings.Join(ids, ", "))
+	}
+
+	_, err = movieCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "imdb_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
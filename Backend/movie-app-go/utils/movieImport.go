@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"movie-app-go/models"
+)
+
+const (
+	ImportFormatJSON   = "json"
+	ImportFormatNDJSON = "ndjson"
+	ImportFormatCSV    = "csv"
+)
+
+// MovieCSVColumns are the columns a CSV import may use, in any order. Genres
+// are written as id:name pairs separated by |, e.g. 28:Action|18:Drama.
+var MovieCSVColumns = []string{
+	"imdb_id", "title", "poster_url", "youtube_id", "genres", "release_year",
+	"description", "admin_review", "ranking_value", "ranking_name",
+}
+
+// ImportFormat picks the format from the format query parameter, falling back
+// to the Content-Type of the request.
+func ImportFormat(format, contentType string) (string, error) {
+	if format == "" {
+		switch {
+		case strings.Contains(contentType, "ndjson"), strings.Contains(contentType, "jsonl"):
+			format = ImportFormatNDJSON
+		case strings.Contains(contentType, "csv"):
+			format = ImportFormatCSV
+		case contentType == "", strings.Contains(contentType, "json"):
+			format = ImportFormatJSON
+		}
+	}
+
+	switch format {
+	case ImportFormatJSON, ImportFormatNDJSON, ImportFormatCSV:
+		return format, nil
+	}
+	return "", errors.New("format must be json, ndjson or csv")
+}
+
+// ReadMovieRows decodes movies one at a time and hands each to row, numbered
+// from 1. A row that can't be decoded is passed with its error and reading
+// goes on, unless the stream itself is broken; that error is returned.
+// Returning false from row stops reading.
+func ReadMovieRows(format string, r io.Reader, row func(number int, movie models.Movie, err error) bool) error {
+	switch format {
+	case ImportFormatNDJSON:
+		return readMovieNDJSON(r, row)
+	case ImportFormatCSV:
+		return readMovieCSV(r, row)
+	default:
+		return readMovieJSONArray(r, row)
+	}
+}
+
+func readMovieJSONArray(r io.Reader, row func(int, models.Movie, error) bool) error {
+	decoder := json.NewDecoder(r)
+
+	token, err := decoder.Token()
+	if err != nil {
+		return fmt.Errorf("reading JSON array: %w", err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return errors.New("expected a JSON array of movies")
+	}
+
+	for number := 1; decoder.More(); number++ {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return fmt.Errorf("row %d: %w", number, err)
+		}
+
+		var movie models.Movie
+		err := json.Unmarshal(raw, &movie)
+		if !row(number, movie, err) {
+			return nil
+		}
+	}
+
+	if _, err := decoder.Token(); err != nil {
+		return fmt.Errorf("reading JSON array: %w", err)
+	}
+	return nil
+}
+
+func readMovieNDJSON(r io.Reader, row func(int, models.Movie, error) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	number := 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		number++
+
+		var movie models.Movie
+		err := json.Unmarshal(line, &movie)
+		if !row(number, movie, err) {
+			return nil
+		}
+	}
+
+	return scanner.Err()
+}
+
+func readMovieCSV(r io.Reader, row func(int, models.Movie, error) bool) error {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("reading CSV header: %w", err)
+	}
+
+	known := map[string]bool{}
+	for _, column := range MovieCSVColumns {
+		known[column] = true
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !known[name] {
+			return fmt.Errorf("unknown CSV column %q", name)
+		}
+		columns[name] = i
+	}
+	reader.FieldsPerRecord = len(header)
+
+	for number := 1; ; number++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) && errors.Is(parseErr.Err, csv.ErrFieldCount) {
+				if !row(number, models.Movie{}, err) {
+					return nil
+				}
+				continue
+			}
+			return fmt.Errorf("row %d: %w", number, err)
+		}
+
+		movie, err := movieFromCSV(record, columns)
+		if !row(number, movie, err) {
+			return nil
+		}
+	}
+}
+
+func movieFromCSV(record []string, columns map[string]int) (models.Movie, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	movie := models.Movie{
+		ImdbID:      field("imdb_id"),
+		Title:       field("title"),
+		PosterURL:   field("poster_url"),
+		YoutubeID:   field("youtube_id"),
+		Description: field("description"),
+		AdminReview: field("admin_review"),
+		Genres:      []models.Genre{},
+	}
+
+	if value := field("release_year"); value != "" {
+		year, err := strconv.Atoi(value)
+		if err != nil {
+			return movie, fmt.Errorf("release_year %q is not a number", value)
+		}
+		movie.ReleaseYear = year
+	}
+
+	if value := field("ranking_value"); value != "" {
+		rankingValue, err := strconv.Atoi(value)
+		if err != nil {
+			return movie, fmt.Errorf("ranking_value %q is not a number", value)
+		}
+		movie.Ranking.RankingValue = rankingValue
+	}
+	movie.Ranking.RankingName = field("ranking_name")
+
+	if value := field("genres"); value != "" {
+		for _, pair := range strings.Split(value, "|") {
+			id, name, ok := strings.Cut(pair, ":")
+			if !ok {
+				return movie, fmt.Errorf("genre %q is not written as id:name", pair)
+			}
+			movie.Genres = append(movie.Genres, models.Genre{GenreID: strings.TrimSpace(id), GenreName: strings.TrimSpace(name)})
+		}
+	}
+
+	return movie, nil
+}
@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"movie-app-go/models"
+)
+
+func TestReadMovieRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		input   string
+		wantIDs []string
+		wantBad []int
+		wantErr string
+	}{
+		{
+			name:    "json array",
+			format:  ImportFormatJSON,
+			input:   `[{"imdb_id":"tt1"},{"imdb_id":"tt2"}]`,
+			wantIDs: []string{"tt1", "tt2"},
+		},
+		{
+			name:    "json bad row in the middle",
+			format:  ImportFormatJSON,
+			input:   `[{"imdb_id":"tt1"},{"imdb_id":"tt2","release_year":"soon"},{"imdb_id":"tt3"}]`,
+			wantIDs: []string{"tt1", "tt2", "tt3"},
+			wantBad: []int{2},
+		},
+		{
+			name:    "json object instead of array",
+			format:  ImportFormatJSON,
+			input:   `{"imdb_id":"tt1"}`,
+			wantErr: "expected a JSON array",
+		},
+		{
+			name:    "json truncated",
+			format:  ImportFormatJSON,
+			input:   `[{"imdb_id":"tt1"},{"imdb_`,
+			wantIDs: []string{"tt1"},
+			wantErr: "row 2",
+		},
+		{
+			name:    "ndjson",
+			format:  ImportFormatNDJSON,
+			input:   "{\"imdb_id\":\"tt1\"}\n{\"imdb_id\":\"tt2\"}\n",
+			wantIDs: []string{"tt1", "tt2"},
+		},
+		{
+			name:    "ndjson blank lines are skipped without being counted",
+			format:  ImportFormatNDJSON,
+			input:   "{\"imdb_id\":\"tt1\"}\n\n   \n{\"imdb_id\":\"tt2\"}\r\n",
+			wantIDs: []string{"tt1", "tt2"},
+		},
+		{
+			name:    "ndjson bad row in the middle",
+			format:  ImportFormatNDJSON,
+			input:   "{\"imdb_id\":\"tt1\"}\n{\"imdb_id\":\n{\"imdb_id\":\"tt3\"}\n",
+			wantIDs: []string{"tt1", "", "tt3"},
+			wantBad: []int{2},
+		},
+		{
+			name:    "ndjson line over 1MB",
+			format:  ImportFormatNDJSON,
+			input:   "{\"imdb_id\":\"tt1\"}\n{\"title\":\"" + strings.Repeat("a", 1024*1024) + "\"}\n",
+			wantIDs: []string{"tt1"},
+			wantErr: "too long",
+		},
+		{
+			name:    "csv columns in any order and case",
+			format:  ImportFormatCSV,
+			input:   "Title, IMDB_ID\nAlpha,tt1\nBeta,tt2\n",
+			wantIDs: []string{"tt1", "tt2"},
+		},
+		{
+			name:    "csv bad row in the middle",
+			format:  ImportFormatCSV,
+			input:   "imdb_id,title,release_year\ntt1,Alpha,1999\ntt2,Beta,soon\ntt3,Gamma,2001\n",
+			wantIDs: []string{"tt1", "tt2", "tt3"},
+			wantBad: []int{2},
+		},
+		{
+			name:    "csv row with an extra column",
+			format:  ImportFormatCSV,
+			input:   "imdb_id,title\ntt1,Alpha\ntt2,Beta,extra\ntt3,Gamma\n",
+			wantIDs: []string{"tt1", "", "tt3"},
+			wantBad: []int{2},
+		},
+		{
+			name:    "csv row with a missing column",
+			format:  ImportFormatCSV,
+			input:   "imdb_id,title\ntt1,Alpha\ntt2\ntt3,Gamma\n",
+			wantIDs: []string{"tt1", "", "tt3"},
+			wantBad: []int{2},
+		},
+		{
+			name:    "csv genres not written as id:name",
+			format:  ImportFormatCSV,
+			input:   "imdb_id,genres\ntt1,28:Action|18:Drama\ntt2,Action\n",
+			wantIDs: []string{"tt1", "tt2"},
+			wantBad: []int{2},
+		},
+		{
+			name:    "csv header with an extra column",
+			format:  ImportFormatCSV,
+			input:   "imdb_id,title,rating\ntt1,Alpha,5\n",
+			wantErr: `unknown CSV column "rating"`,
+		},
+		{
+			name:    "csv without a header",
+			format:  ImportFormatCSV,
+			input:   "tt1,Alpha,1999\n",
+			wantErr: `unknown CSV column "tt1"`,
+		},
+		{
+			name:    "empty csv",
+			format:  ImportFormatCSV,
+			input:   "",
+			wantErr: "reading CSV header",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := []string{}
+			bad := []int{}
+			next := 1
+
+			err := ReadMovieRows(tt.format, strings.NewReader(tt.input), func(number int, movie models.Movie, err error) bool {
+				if number != next {
+					t.Fatalf("got row %d, want %d", number, next)
+				}
+				next++
+
+				ids = append(ids, movie.ImdbID)
+				if err != nil {
+					bad = append(bad, number)
+				}
+				return true
+			})
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ReadMovieRows error = %v, want one containing %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("ReadMovieRows: %v", err)
+			}
+
+			wantIDs := tt.wantIDs
+			if wantIDs == nil {
+				wantIDs = []string{}
+			}
+			if !reflect.DeepEqual(ids, wantIDs) {
+				t.Errorf("imdb ids = %v, want %v", ids, wantIDs)
+			}
+
+			wantBad := tt.wantBad
+			if wantBad == nil {
+				wantBad = []int{}
+			}
+			if !reflect.DeepEqual(bad, wantBad) {
+				t.Errorf("bad rows = %v, want %v", bad, wantBad)
+			}
+		})
+	}
+}
+
+func TestReadMovieRowsStopsWhenAsked(t *testing.T) {
+	inputs := map[string]string{
+		ImportFormatJSON:   `[{"imdb_id":"tt1"},{"imdb_id":"tt2"},{"imdb_id":"tt3"}]`,
+		ImportFormatNDJSON: "{\"imdb_id\":\"tt1\"}\n{\"imdb_id\":\"tt2\"}\n{\"imdb_id\":\"tt3\"}\n",
+		ImportFormatCSV:    "imdb_id\ntt1\ntt2\ntt3\n",
+	}
+
+	for format, input := range inputs {
+		t.Run(format, func(t *testing.T) {
+			rows := 0
+			err := ReadMovieRows(format, strings.NewReader(input), func(int, models.Movie, error) bool {
+				rows++
+				return rows < 2
+			})
+			if err != nil {
+				t.Fatalf("ReadMovieRows: %v", err)
+			}
+			if rows != 2 {
+				t.Fatalf("read %d rows, want 2", rows)
+			}
+		})
+	}
+}
+
+func TestImportFormat(t *testing.T) {
+	tests := []struct {
+		format      string
+		contentType string
+		want        string
+		wantErr     bool
+	}{
+		{contentType: "", want: ImportFormatJSON},
+		{contentType: "application/json", want: ImportFormatJSON},
+		{contentType: "application/x-ndjson", want: ImportFormatNDJSON},
+		{contentType: "application/jsonl", want: ImportFormatNDJSON},
+		{contentType: "text/csv", want: ImportFormatCSV},
+		{format: "csv", contentType: "application/json", want: ImportFormatCSV},
+		{contentType: "application/xml", wantErr: true},
+		{format: "xml", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ImportFormat(tt.format, tt.contentType)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ImportFormat(%q, %q) = %q, %v; want %q, error %v", tt.format, tt.contentType, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+	"movie-app-go/secrets"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"golang.org/x/oauth2"
+)
+
+const OIDCLoginStateTTL = 10 * time.Minute
+
+const OIDC_CLIENT_SECRET = "OIDC_CLIENT_SECRET"
+
+var ErrOIDCNotConfigured = errors.New("OIDC login is not configured")
+var ErrInvalidOIDCState = errors.New("invalid or expired OIDC login state")
+
+func init() {
+	secrets.Default.Register(secrets.Spec{Name: OIDC_CLIENT_SECRET, Optional: true})
+}
+
+// OIDCClient is a discovered OpenID Connect provider together with our
+// client registration at it.
+type OIDCClient struct {
+	Issuer   string
+	Verifier *oidc.IDTokenVerifier
+	OAuth2   oauth2.Config
+}
+
+var (
+	oidcMu     sync.Mutex
+	oidcClient *OIDCClient
+)
+
+func OIDCEnabled() bool {
+	return os.Getenv("OIDC_ISSUER_URL") != ""
+}
+
+// GetOIDCClient discovers the provider named by OIDC_ISSUER_URL on first use
+// and caches it. A failed discovery is retried on the next call, so the API
+// can start before the provider is reachable.
+func GetOIDCClient() (*OIDCClient, error) {
+	issuer := os.Getenv("OIDC_ISSUER_URL")
+	if issuer == "" {
+		return nil, ErrOIDCNotConfigured
+	}
+
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+
+	if oidcClient != nil {
+		return oidcClient, nil
+	}
+
+	clientId := os.Getenv("OIDC_CLIENT_ID")
+	if clientId == "" {
+		return nil, errors.New("OIDC_CLIENT_ID not set in environment")
+	}
+
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if redirectURL == "" {
+		return nil, errors.New("OIDC_REDIRECT_URL not set in environment")
+	}
+
+	scopes := []string{oidc.ScopeOpenID, "email", "profile"}
+	if extra := os.Getenv("OIDC_SCOPES"); extra != "" {
+		scopes = []string{oidc.ScopeOpenID}
+		for _, scope := range strings.Split(extra, ",") {
+			if scope = strings.TrimSpace(scope); scope != "" && scope != oidc.ScopeOpenID {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+
+	discovered, err := NewOIDCClient(issuer, clientId, secrets.Get(OIDC_CLIENT_SECRET), redirectURL, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	oidcClient = discovered
+	return oidcClient, nil
+}
+
+// NewOIDCClient discovers the provider at issuer and registers our client
+// with it.
+func NewOIDCClient(issuer, clientId, clientSecret, redirectURL string, scopes []string) (*OIDCClient, error) {
+	// The provider keeps this context to fetch signing keys later on
+	ctx := oidc.ClientContext(context.Background(), &http.Client{Timeout: 10 * time.Second})
+
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OIDCClient{
+		Issuer:   issuer,
+		Verifier: provider.Verifier(&oidc.Config{ClientID: clientId}),
+		OAuth2: oauth2.Config{
+			ClientID:     clientId,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+	}, nil
+}
+
+// ReloadOIDCClient picks up a rotated OIDC_CLIENT_SECRET without discovering
+// the provider again. Logins already under way keep the client they started
+// with.
+func ReloadOIDCClient() error {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+
+	if oidcClient == nil {
+		return nil
+	}
+
+	reloaded := *oidcClient
+	reloaded.OAuth2.ClientSecret = secrets.Get(OIDC_CLIENT_SECRET)
+	oidcClient = &reloaded
+	return nil
+}
+
+// SaveOIDCLoginState stores what the callback needs to finish the flow. The
+// state itself is only stored hashed.
+func SaveOIDCLoginState(ctx context.Context, client *mongo.Client, state, nonce, codeVerifier string) error {
+	now := time.Now()
+
+	var stateCollection *mongo.Collection = database.OpenCollection(client, "oidc_login_states")
+	_, err := stateCollection.InsertOne(ctx, models.OIDCLoginState{
+		StateHash:    HashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(OIDCLoginStateTTL),
+	})
+	return err
+}
+
+// ConsumeOIDCLoginState returns the stored login state and deletes it so a
+// callback URL can't be replayed.
+func ConsumeOIDCLoginState(ctx context.Context, client *mongo.Client, state string) (*models.OIDCLoginState, error) {
+	var stateCollection *mongo.Collection = database.OpenCollection(client, "oidc_login_states")
+
+	var loginState models.OIDCLoginState
+	err := stateCollection.FindOneAndDelete(
+		ctx,
+		bson.M{"state_hash": HashToken(state), "expires_at": bson.M{"$gt": time.Now()}},
+	).Decode(&loginState)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrInvalidOIDCState
+		}
+		return nil, err
+	}
+
+	return &loginState, nil
+}
+
+func EnsureOIDCLoginStateIndexes(client *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var stateCollection *mongo.Collection = database.OpenCollection(client, "oidc_login_states")
+	_, err := stateCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "state_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const PasswordResetTTL = time.Hour
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// NewOpaqueToken returns a random URL-safe token to hand out in links.
+func NewOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// CreatePasswordResetToken issues a new reset token for the user and drops
+// any earlier one that was not used yet.
+func CreatePasswordResetToken(userId string, client *mongo.Client) (string, error) {
+	token, err := NewOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var resetCollection *mongo.Collection = database.OpenCollection(client, "password_resets")
+
+	if _, err := resetCollection.DeleteMany(ctx, bson.M{"user_id": userId, "used": false}); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	_, err = resetCollection.InsertOne(ctx, models.PasswordReset{
+		TokenHash: HashToken(token),
+		UserID:    userId,
+		CreatedAt: now,
+		ExpiresAt: now.Add(PasswordResetTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// ConsumePasswordResetToken marks the token as used and returns the user it
+// was issued for. A token can only be consumed once.
+func ConsumePasswordResetToken(token string, client *mongo.Client) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var resetCollection *mongo.Collection = database.OpenCollection(client, "password_resets")
+
+	var reset models.PasswordReset
+	err := resetCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"token_hash": HashToken(token), "used": false, "expires_at": bson.M{"$gt": time.Now()}},
+		bson.M{"$set": bson.M{"used": true}},
+	).Decode(&reset)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", ErrInvalidResetToken
+		}
+		return "", err
+	}
+
+	return reset.UserID, nil
+}
+
+func EnsurePasswordResetIndexes(client *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var resetCollection *mongo.Collection = database.OpenCollection(client, "password_resets")
+	_, err := resetCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashAndVerifyPassword(t *testing.T) {
+	encoded, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if !strings.HasPrefix(encoded, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Fatalf("HashPassword = %q, want an Argon2id PHC string with the default parameters", encoded)
+	}
+
+	again, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	if again == encoded {
+		t.Fatal("two hashes of the same password are equal, the salt isn't random")
+	}
+
+	ok, needsRehash, err := VerifyPassword(encoded, "correct horse battery staple")
+	if err != nil || !ok {
+		t.Fatalf("VerifyPassword = %v, %v, want a match", ok, err)
+	}
+	if needsRehash {
+		t.Fatal("a hash with the default parameters needs a rehash")
+	}
+
+	ok, _, err = VerifyPassword(encoded, "Correct horse battery staple")
+	if err != nil || ok {
+		t.Fatalf("VerifyPassword with the wrong password = %v, %v, want no match and no error", ok, err)
+	}
+}
+
+func TestVerifyPasswordUpgradesOlderHashes(t *testing.T) {
+	bcryptHash, err := bcrypt.GenerateFromPassword([]byte("AdminPass123!"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt: %v", err)
+	}
+	weakArgon2id, err := Argon2idHasher{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}.Hash("AdminPass123!")
+	if err != nil {
+		t.Fatalf("hashing with weak parameters: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{name: "bcrypt", encoded: string(bcryptHash)},
+		{name: "argon2id below the defaults", encoded: weakArgon2id},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash, err := VerifyPassword(tt.encoded, "AdminPass123!")
+			if err != nil || !ok {
+				t.Fatalf("VerifyPassword = %v, %v, want a match", ok, err)
+			}
+			if !needsRehash {
+				t.Fatal("VerifyPassword didn't ask for a rehash")
+			}
+
+			// Whatever the login stores instead is a current Argon2id hash
+			rehashed, err := HashPassword("AdminPass123!")
+			if err != nil {
+				t.Fatalf("HashPassword: %v", err)
+			}
+			if ok, needsRehash, err := VerifyPassword(rehashed, "AdminPass123!"); !ok || needsRehash || err != nil {
+				t.Fatalf("VerifyPassword after rehash = %v, %v, %v; want a match without rehash", ok, needsRehash, err)
+			}
+
+			ok, needsRehash, err = VerifyPassword(tt.encoded, "wrong password")
+			if err != nil || ok || needsRehash {
+				t.Fatalf("VerifyPassword with the wrong password = %v, %v, %v; want no match", ok, needsRehash, err)
+			}
+		})
+	}
+}
+
+func TestVerifyPasswordRejectsMalformedHashes(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{name: "empty", encoded: ""},
+		{name: "plain text", encoded: "AdminPass123!"},
+		{name: "unknown algorithm", encoded: "$scrypt$ln=15,r=8,p=1$c2FsdA$a2V5"},
+		{name: "missing key", encoded: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdHNhbHRzYWx0c2FsdA"},
+		{name: "empty key", encoded: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdHNhbHRzYWx0c2FsdA$"},
+		{name: "extra segment", encoded: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA$a2V5$more"},
+		{name: "other version", encoded: "$argon2id$v=16$m=19456,t=2,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5"},
+		{name: "garbled version", encoded: "$argon2id$version$m=19456,t=2,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5"},
+		{name: "garbled parameters", encoded: "$argon2id$v=19$m=lots$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5"},
+		{name: "zero iterations", encoded: "$argon2id$v=19$m=19456,t=0,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5"},
+		{name: "zero threads", encoded: "$argon2id$v=19$m=19456,t=2,p=0$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5"},
+		{name: "threads out of range", encoded: "$argon2id$v=19$m=19456,t=2,p=300$c2FsdHNhbHRzYWx0c2FsdA$a2V5a2V5a2V5a2V5"},
+		{name: "salt that isn't base64", encoded: "$argon2id$v=19$m=19456,t=2,p=1$!!!$a2V5a2V5a2V5a2V5"},
+		{name: "key that isn't base64", encoded: "$argon2id$v=19$m=19456,t=2,p=1$c2FsdHNhbHRzYWx0c2FsdA$!!!"},
+		{name: "truncated bcrypt", encoded: "$2a$10$abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, needsRehash, err := VerifyPassword(tt.encoded, "AdminPass123!")
+			if ok || needsRehash {
+				t.Fatalf("VerifyPassword = %v, %v, want no match", ok, needsRehash)
+			}
+			if err == nil {
+				t.Fatal("VerifyPassword returned no error for a malformed hash")
+			}
+		})
+	}
+
+	if _, _, err := VerifyPassword("AdminPass123!", "AdminPass123!"); !errors.Is(err, ErrUnknownPasswordHash) {
+		t.Fatalf("VerifyPassword of a plain text password error = %v, want ErrUnknownPasswordHash", err)
+	}
+}
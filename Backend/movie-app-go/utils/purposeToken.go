@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"movie-app-go/database"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const EmailVerificationTTL = time.Hour * 24
+const TwoFactorChallengeTTL = time.Minute * 5
+
+// Audiences of purpose tokens. Access tokens never carry one.
+const (
+	EmailVerificationAudience  = "email-verification"
+	TwoFactorChallengeAudience = "2fa-challenge"
+)
+
+// PurposeTokenType is the typ header of purpose tokens. They are signed with
+// the keys published at /.well-known/jwks.json, so services checking access
+// tokens with those keys must refuse this type.
+const PurposeTokenType = "purpose+jwt"
+
+// PurposeClaims are carried by short-lived tokens that prove one thing about
+// a user, such as owning an email address or having passed the password step
+// of a login.
+type PurposeClaims struct {
+	Email string
+	jwt.RegisteredClaims
+}
+
+// GeneratePurposeToken signs a token for a single purpose with the active
+// signing key. Its type keeps it from ever being accepted as an access token,
+// and its audience from being used for another purpose.
+func GeneratePurposeToken(audience, userId, email string, ttl time.Duration) (string, error) {
+	signingKey, err := Keys.Active()
+	if err != nil {
+		return "", err
+	}
+
+	claims := &PurposeClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        bson.NewObjectID().Hex(),
+			Issuer:    "movie-app-go",
+			Subject:   userId,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		},
+	}
+
+	token := jwt.NewWithClaims(signingKey.Method, claims)
+	token.Header["kid"] = signingKey.Kid
+	token.Header["typ"] = PurposeTokenType
+	return token.SignedString(signingKey.Private)
+}
+
+func ValidatePurposeToken(tokenStr, audience string) (*PurposeClaims, error) {
+	claims := &PurposeClaims{}
+
+	_, err := jwt.ParseWithClaims(
+		tokenStr,
+		claims,
+		func(token *jwt.Token) (interface{}, error) {
+			if typ, _ := token.Header["typ"].(string); typ != PurposeTokenType {
+				return nil, errors.New("not a purpose token")
+			}
+
+			kid, _ := token.Header["kid"].(string)
+
+			key, ok := Keys.Lookup(kid)
+			if !ok {
+				return nil, errors.New("unknown signing key")
+			}
+
+			if token.Method.Alg() != key.Method.Alg() {
+				return nil, errors.New("unexpected signing method")
+			}
+
+			return key.Public, nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	return claims, nil
+}
+
+// EmailVerificationRequired reports whether Login refuses unverified accounts.
+func EmailVerificationRequired() bool {
+	required, _ := strconv.ParseBool(os.Getenv("REQUIRE_EMAIL_VERIFICATION"))
+	return required
+}
+
+// VerificationResendInterval is the minimum time between two verification
+// emails for the same account.
+func VerificationResendInterval() time.Duration {
+	if interval, err := time.ParseDuration(os.Getenv("VERIFICATION_RESEND_INTERVAL")); err == nil && interval > 0 {
+		return interval
+	}
+	return time.Minute
+}
+
+// PasswordResetInterval is the minimum time between two password reset
+// emails for the same account.
+func PasswordResetInterval() time.Duration {
+	if interval, err := time.ParseDuration(os.Getenv("PASSWORD_RESET_INTERVAL")); err == nil && interval > 0 {
+		return interval
+	}
+	return time.Minute
+}
+
+// ClaimEmailSlot sets the user's sentAtField to now unless it is less than
+// interval old, and reports whether it did. Checking and claiming in one
+// update means parallel requests can't both send an email.
+func ClaimEmailSlot(ctx context.Context, client *mongo.Client, userId, sentAtField string, interval time.Duration) (bool, error) {
+	now := time.Now()
+
+	var userCollection *mongo.Collection = database.OpenCollection(client, "users")
+	result, err := userCollection.UpdateOne(
+		ctx,
+		bson.M{
+			"user_id": userId,
+			"$or": bson.A{
+				bson.M{sentAtField: bson.M{"$exists": false}},
+				bson.M{sentAtField: bson.M{"$lte": now.Add(-interval)}},
+			},
+		},
+		bson.M{"$set": bson.M{sentAtField: now}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
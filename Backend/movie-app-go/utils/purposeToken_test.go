@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// useTestSigningKey signs and checks tokens with a throwaway key.
+func useTestSigningKey(t *testing.T) *SigningKey {
+	t.Helper()
+
+	key, err := NewEphemeralSigningKey()
+	if err != nil {
+		t.Fatalf("generating signing key: %v", err)
+	}
+	previousActive, _ := Keys.Active()
+	previousKeys := Keys.All()
+	Keys.Replace(key, []*SigningKey{key})
+	t.Cleanup(func() { Keys.Replace(previousActive, previousKeys) })
+
+	return key
+}
+
+// signWithHeader signs claims with key and the given typ header.
+func signWithHeader(t *testing.T, key *SigningKey, typ string, claims jwt.Claims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.Kid
+	token.Header["typ"] = typ
+	signed, err := token.SignedString(key.Private)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return signed
+}
+
+func TestPurposeTokensAreNotAccessTokens(t *testing.T) {
+	useTestSigningKey(t)
+
+	token, err := GeneratePurposeToken(EmailVerificationAudience, "user-1", "user@example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("GeneratePurposeToken: %v", err)
+	}
+
+	claims, err := ValidatePurposeToken(token, EmailVerificationAudience)
+	if err != nil {
+		t.Fatalf("ValidatePurposeToken: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "user@example.com" {
+		t.Fatalf("claims = %+v, want the user and email the token was made for", claims)
+	}
+
+	if _, err := ValidatePurposeToken(token, TwoFactorChallengeAudience); err == nil {
+		t.Fatal("an email verification token passed as a two-factor challenge")
+	}
+	if _, err := ValidateToken(token); err == nil {
+		t.Fatal("a purpose token passed as an access token")
+	}
+}
+
+func TestPurposeTokensNeedTheirType(t *testing.T) {
+	key := useTestSigningKey(t)
+
+	now := time.Now()
+	purposeClaims := &PurposeClaims{
+		Email: "user@example.com",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        bson.NewObjectID().Hex(),
+			Issuer:    "movie-app-go",
+			Subject:   "user-1",
+			Audience:  jwt.ClaimStrings{TwoFactorChallengeAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}
+	accessClaims := &SigninDetails{
+		UserId:   "user-1",
+		Role:     "USER",
+		FamilyId: NewTokenFamilyID(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        bson.NewObjectID().Hex(),
+			Issuer:    "movie-app-go",
+			Subject:   "user-1",
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	}
+
+	// The audience alone isn't enough, the type must match too
+	if _, err := ValidatePurposeToken(signWithHeader(t, key, "JWT", purposeClaims), TwoFactorChallengeAudience); err == nil {
+		t.Fatal("a token without the purpose type passed as a purpose token")
+	}
+
+	// And the type alone keeps a token without an audience from being used
+	// as an access token
+	if _, err := ValidateToken(signWithHeader(t, key, PurposeTokenType, accessClaims)); err == nil {
+		t.Fatal("a purpose-typed token passed as an access token")
+	}
+
+	accessToken, err := signAccessToken(accessClaims)
+	if err != nil {
+		t.Fatalf("signAccessToken: %v", err)
+	}
+	if _, err := ValidateToken(accessToken); err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if _, err := ValidatePurposeToken(accessToken, TwoFactorChallengeAudience); err == nil {
+		t.Fatal("an access token passed as a purpose token")
+	}
+}
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"movie-app-go/database"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// RevocationStore keeps track of access tokens that must be refused before
+// they expire. A single token is revoked by its jti and a session's tokens by
+// their family id; all of a user's tokens are revoked by recording a cutoff
+// that older tokens' iat must not precede.
+type RevocationStore interface {
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	RevokeFamilyTokens(ctx context.Context, familyId string) error
+	RevokeUserTokens(ctx context.Context, userId string) error
+	IsRevoked(ctx context.Context, claims *SigninDetails) (bool, error)
+}
+
+// Revocations is the store used by AuthenticationMiddleware and the
+// controllers. main replaces it with a Mongo store unless configured otherwise.
+var Revocations RevocationStore = NewMemoryRevocationStore()
+
+var ErrMissingTokenID = errors.New("token has no jti")
+
+// userCutoff truncates to whole seconds because iat is encoded in seconds.
+// Tokens issued within the same second as the revocation stay valid, so the
+// session started right after a password change survives; suspensions and
+// bans are enforced by AuthenticationMiddleware checking the account anyway.
+func userCutoff() time.Time {
+	return time.Now().Truncate(time.Second)
+}
+
+func issuedBefore(claims *SigninDetails, cutoff time.Time) bool {
+	if claims.IssuedAt == nil {
+		return true
+	}
+	return claims.IssuedAt.Time.Before(cutoff)
+}
+
+// RevokeAccessToken revokes the token behind the given claims until it would
+// have expired on its own.
+func RevokeAccessToken(ctx context.Context, claims *SigninDetails) error {
+	if claims.ID == "" {
+		return ErrMissingTokenID
+	}
+
+	expiresAt := time.Now().Add(AccessTokenTTL)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+
+	return Revocations.RevokeToken(ctx, claims.ID, expiresAt)
+}
+
+type MemoryRevocationStore struct {
+	mu       sync.Mutex
+	tokens   map[string]time.Time
+	families map[string]time.Time
+	cutoffs  map[string]time.Time
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens:   map[string]time.Time{},
+		families: map[string]time.Time{},
+		cutoffs:  map[string]time.Time{},
+	}
+}
+
+func (s *MemoryRevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge()
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+// RevokeFamilyTokens keeps the entry for as long as the family's newest access
+// token can live, since a revoked family can't be refreshed any more.
+func (s *MemoryRevocationStore) RevokeFamilyTokens(ctx context.Context, familyId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge()
+	s.families[familyId] = time.Now().Add(AccessTokenTTL)
+	return nil
+}
+
+func (s *MemoryRevocationStore) RevokeUserTokens(ctx context.Context, userId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.purge()
+	s.cutoffs[userId] = userCutoff()
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(ctx context.Context, claims *SigninDetails) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tokens[claims.ID]; ok {
+		return true, nil
+	}
+
+	if _, ok := s.families[claims.FamilyId]; ok && claims.FamilyId != "" {
+		return true, nil
+	}
+
+	if cutoff, ok := s.cutoffs[claims.UserId]; ok && issuedBefore(claims, cutoff) {
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// purge drops entries whose tokens have expired anyway. Callers hold s.mu.
+func (s *MemoryRevocationStore) purge() {
+	now := time.Now()
+
+	for jti, expiresAt := range s.tokens {
+		if expiresAt.Before(now) {
+			delete(s.tokens, jti)
+		}
+	}
+
+	for familyId, expiresAt := range s.families {
+		if expiresAt.Before(now) {
+			delete(s.families, familyId)
+		}
+	}
+
+	for userId, cutoff := range s.cutoffs {
+		if cutoff.Add(AccessTokenTTL).Before(now) {
+			delete(s.cutoffs, userId)
+		}
+	}
+}
+
+type MongoRevocationStore struct {
+	client *mongo.Client
+}
+
+func NewMongoRevocationStore(client *mongo.Client) *MongoRevocationStore {
+	return &MongoRevocationStore{client: client}
+}
+
+func (s *MongoRevocationStore) collection() *mongo.Collection {
+	return database.OpenCollection(s.client, "revoked_tokens")
+}
+
+func (s *MongoRevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := s.collection().UpdateOne(
+		ctx,
+		bson.M{"jti": jti},
+		bson.M{"$set": bson.M{"jti": jti, "expires_at": expiresAt}},
+		options.UpdateOne().SetUpsert(true),
+	)
+	return err
+}
+
+func (s *MongoRevocationStore) RevokeFamilyTokens(ctx context.Context, familyId string) error {
+	_, err := s.collection().UpdateOne(
+		ctx,
+		bson.M{"family_id": familyId},
+		bson.M{"$set": bson.M{"family_id": familyId, "expires_at": time.Now().Add(AccessTokenTTL)}},
+		options.UpdateOne().SetUpsert(true),
+	)
+	return err
+}
+
+func (s *MongoRevocationStore) RevokeUserTokens(ctx context.Context, userId string) error {
+	cutoff := userCutoff()
+
+	_, err := s.collection().UpdateOne(
+		ctx,
+		bson.M{"user_id": userId},
+		bson.M{"$max": bson.M{
+			"revoked_before": cutoff,
+			"expires_at":     cutoff.Add(AccessTokenTTL),
+		}},
+		options.UpdateOne().SetUpsert(true),
+	)
+	return err
+}
+
+func (s *MongoRevocationStore) IsRevoked(ctx context.Context, claims *SigninDetails) (bool, error) {
+	userFilter := bson.M{"user_id": claims.UserId}
+	if claims.IssuedAt != nil {
+		userFilter["revoked_before"] = bson.M{"$gt": claims.IssuedAt.Time}
+	}
+
+	conditions := bson.A{bson.M{"jti": claims.ID}, userFilter}
+	if claims.FamilyId != "" {
+		conditions = append(conditions, bson.M{"family_id": claims.FamilyId})
+	}
+
+	filter := bson.M{"$or": conditions}
+
+	count, err := s.collection().CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// EnsureIndexes lets Mongo drop revocations once the tokens they cover have
+// expired.
+func (s *MongoRevocationStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "jti", Value: 1}},
+			Options: options.Index().SetUnique(true).SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "family_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true).SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
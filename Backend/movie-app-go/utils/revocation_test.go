@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// accessClaims returns the claims of an access token issued at iat.
+func accessClaims(userId, familyId string, iat time.Time) *SigninDetails {
+	return &SigninDetails{
+		UserId:   userId,
+		FamilyId: familyId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        bson.NewObjectID().Hex(),
+			IssuedAt:  jwt.NewNumericDate(iat),
+			ExpiresAt: jwt.NewNumericDate(iat.Add(AccessTokenTTL)),
+		},
+	}
+}
+
+func TestRevocationStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) RevocationStore{
+		"memory": func(t *testing.T) RevocationStore {
+			return NewMemoryRevocationStore()
+		},
+		"mongo": func(t *testing.T) RevocationStore {
+			store := NewMongoRevocationStore(testMongoClient(t))
+			if err := store.EnsureIndexes(context.Background()); err != nil {
+				t.Fatalf("creating indexes: %v", err)
+			}
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			ctx := context.Background()
+
+			isRevoked := func(claims *SigninDetails) bool {
+				t.Helper()
+				revoked, err := store.IsRevoked(ctx, claims)
+				if err != nil {
+					t.Fatalf("IsRevoked: %v", err)
+				}
+				return revoked
+			}
+
+			earlier := time.Now().Add(-time.Minute)
+
+			t.Run("jti", func(t *testing.T) {
+				revokedToken := accessClaims("user-jti", "family-jti", earlier)
+				sameSession := accessClaims("user-jti", "family-jti", earlier)
+
+				if err := store.RevokeToken(ctx, revokedToken.ID, revokedToken.ExpiresAt.Time); err != nil {
+					t.Fatalf("RevokeToken: %v", err)
+				}
+				if !isRevoked(revokedToken) {
+					t.Error("revoked token is still valid")
+				}
+				if isRevoked(sameSession) {
+					t.Error("another token of the session was revoked with it")
+				}
+			})
+
+			t.Run("family", func(t *testing.T) {
+				first := accessClaims("user-family", "family-a", earlier)
+				second := accessClaims("user-family", "family-a", time.Now())
+				otherSession := accessClaims("user-family", "family-b", earlier)
+
+				if err := store.RevokeFamilyTokens(ctx, "family-a"); err != nil {
+					t.Fatalf("RevokeFamilyTokens: %v", err)
+				}
+				if !isRevoked(first) || !isRevoked(second) {
+					t.Error("a token of the revoked session is still valid")
+				}
+				if isRevoked(otherSession) {
+					t.Error("the user's other session was revoked too")
+				}
+			})
+
+			t.Run("user cutoff", func(t *testing.T) {
+				before := accessClaims("user-cutoff", "family-c", time.Now().Add(-2*time.Second))
+				otherUser := accessClaims("someone-else", "family-d", time.Now().Add(-2*time.Second))
+
+				if err := store.RevokeUserTokens(ctx, "user-cutoff"); err != nil {
+					t.Fatalf("RevokeUserTokens: %v", err)
+				}
+				after := accessClaims("user-cutoff", "family-e", time.Now().Truncate(time.Second).Add(time.Second))
+
+				if !isRevoked(before) {
+					t.Error("token issued before the cutoff is still valid")
+				}
+				if isRevoked(after) {
+					t.Error("token issued after the cutoff was revoked")
+				}
+				if isRevoked(otherUser) {
+					t.Error("another user's token was revoked")
+				}
+			})
+		})
+	}
+}
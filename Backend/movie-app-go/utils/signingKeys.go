@@ -0,0 +1,273 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	jwt "github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one asymmetric key identified by its kid. Keys without a
+// private half can only verify tokens, which is how retired keys are kept
+// around until the tokens they signed have expired.
+type SigningKey struct {
+	Kid     string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// KeySet holds the key used to sign new access tokens and every key that is
+// still accepted when verifying them.
+type KeySet struct {
+	mu     sync.RWMutex
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// Keys is loaded by main before any token is issued.
+var Keys = &KeySet{keys: map[string]*SigningKey{}}
+
+var ErrNoSigningKey = errors.New("no active signing key")
+
+// MinRSAKeyBits is the smallest RSA modulus accepted for signing or
+// verifying access tokens.
+const MinRSAKeyBits = 2048
+
+func (ks *KeySet) Active() (*SigningKey, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if ks.active == nil {
+		return nil, ErrNoSigningKey
+	}
+	return ks.active, nil
+}
+
+func (ks *KeySet) Lookup(kid string) (*SigningKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// Replace swaps the keys atomically so tokens keep validating while keys are
+// rotated.
+func (ks *KeySet) Replace(active *SigningKey, keys []*SigningKey) {
+	byKid := make(map[string]*SigningKey, len(keys))
+	for _, key := range keys {
+		byKid[key.Kid] = key
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.active = active
+	ks.keys = byKid
+}
+
+func (ks *KeySet) All() []*SigningKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	keys := make([]*SigningKey, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Kid < keys[j].Kid })
+	return keys
+}
+
+// LoadSigningKeys reads every PEM file of dir. The kid is the file name
+// without its extension; "<kid>.pem" holds a PKCS#8 private key and
+// "<kid>.pub.pem" a PKIX public key for a retired key. activeKid selects the
+// signing key; when empty the greatest kid with a private key is used.
+func LoadSigningKeys(dir, activeKid string) (*SigningKey, []*SigningKey, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var keys []*SigningKey
+	var active *SigningKey
+
+	sort.Strings(paths)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		name := filepath.Base(path)
+		var key *SigningKey
+		if strings.HasSuffix(name, ".pub.pem") {
+			key, err = parsePublicKey(strings.TrimSuffix(name, ".pub.pem"), data)
+		} else {
+			key, err = parsePrivateKey(strings.TrimSuffix(name, ".pem"), data)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		keys = append(keys, key)
+
+		if key.Private == nil {
+			continue
+		}
+		if activeKid == "" || key.Kid == activeKid {
+			active = key
+		}
+	}
+
+	if active == nil {
+		if activeKid != "" {
+			return nil, nil, fmt.Errorf("no private key found for kid %q in %s", activeKid, dir)
+		}
+		return nil, nil, fmt.Errorf("no private key found in %s", dir)
+	}
+
+	return active, keys, nil
+}
+
+// NewEphemeralSigningKey generates an Ed25519 key that only lives as long as
+// the process. It is meant for local development.
+func NewEphemeralSigningKey() (*SigningKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		Kid:     "ephemeral-" + NewTokenFamilyID(),
+		Method:  jwt.SigningMethodEdDSA,
+		Private: private,
+		Public:  public,
+	}, nil
+}
+
+func parsePrivateKey(kid string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		if err := checkRSAKeySize(&private.PublicKey); err != nil {
+			return nil, err
+		}
+		return &SigningKey{Kid: kid, Method: jwt.SigningMethodRS256, Private: private, Public: &private.PublicKey}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{Kid: kid, Method: jwt.SigningMethodEdDSA, Private: private, Public: private.Public()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+}
+
+func parsePublicKey(kid string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch public := parsed.(type) {
+	case *rsa.PublicKey:
+		if err := checkRSAKeySize(public); err != nil {
+			return nil, err
+		}
+		return &SigningKey{Kid: kid, Method: jwt.SigningMethodRS256, Public: public}, nil
+	case ed25519.PublicKey:
+		return &SigningKey{Kid: kid, Method: jwt.SigningMethodEdDSA, Public: public}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", parsed)
+	}
+}
+
+func checkRSAKeySize(key *rsa.PublicKey) error {
+	if bits := key.N.BitLen(); bits < MinRSAKeyBits {
+		return fmt.Errorf("RSA key is %d bits, at least %d are required", bits, MinRSAKeyBits)
+	}
+	return nil
+}
+
+// JWK is the RFC 7517 representation of a public verification key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+
+	for _, key := range ks.All() {
+		jwk := JWK{Kid: key.Kid, Use: "sig", Alg: key.Method.Alg()}
+
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+// ReloadSigningKeys loads Keys from the directory named by
+// JWT_SIGNING_KEYS_DIR, signing with JWT_ACTIVE_KID.
+func ReloadSigningKeys() error {
+	dir := os.Getenv("JWT_SIGNING_KEYS_DIR")
+	if dir == "" {
+		return errors.New("JWT_SIGNING_KEYS_DIR not set")
+	}
+
+	active, keys, err := LoadSigningKeys(dir, os.Getenv("JWT_ACTIVE_KID"))
+	if err != nil {
+		return err
+	}
+
+	Keys.Replace(active, keys)
+	return nil
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// testMongoClient connects to the MongoDB at MONGO_TEST_URI and points
+// database.OpenCollection at a fresh database that is dropped afterwards.
+// Tests using it are skipped when MONGO_TEST_URI isn't set.
+func testMongoClient(t *testing.T) *mongo.Client {
+	t.Helper()
+
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI not set")
+	}
+
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connecting to MongoDB: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatalf("pinging MongoDB: %v", err)
+	}
+
+	// OpenCollection loads .env, which doesn't override variables already set
+	dbName := "movie_app_test_" + bson.NewObjectID().Hex()
+	t.Setenv("MONGO_DB_NAME", dbName)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ".env"), nil, 0o600); err != nil {
+		t.Fatalf("writing .env: %v", err)
+	}
+	t.Chdir(dir)
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		client.Database(dbName).Drop(ctx)
+		client.Disconnect(ctx)
+	})
+
+	return client
+}
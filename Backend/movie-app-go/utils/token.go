@@ -1,17 +1,14 @@
 package utils
 
 import (
-	"context"
 	"errors"
-	"os"
 	"time"
 
-	"movie-app-go/database"
+	"movie-app-go/secrets"
 
 	"github.com/gin-gonic/gin"
 	jwt "github.com/golang-jwt/jwt/v5"
 	"go.mongodb.org/mongo-driver/v2/bson"
-	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 type SigninDetails struct {
@@ -20,28 +17,42 @@ type SigninDetails struct {
 	LastName  string
 	Role      string
 	UserId    string
+	FamilyId  string
+	TwoFactor bool
 	jwt.RegisteredClaims
 }
 
-var JWT_SECRET_KEY = os.Getenv("JWT_SECRET_KEY")
-var JWT_REFRESH_SECRET_KEY = os.Getenv("JWT_REFRESH_SECRET_KEY")
+const JWT_REFRESH_SECRET_KEY = "JWT_REFRESH_SECRET_KEY"
 
-func GenerateAllTokens(userId, firstName, lastName, email, role string) (string, string, error) {
+func init() {
+	secrets.Default.Register(secrets.Spec{Name: JWT_REFRESH_SECRET_KEY, MinLength: 32})
+}
+
+func refreshSecret() []byte {
+	return []byte(secrets.Get(JWT_REFRESH_SECRET_KEY))
+}
+
+const AccessTokenTTL = time.Hour * 24
+const RefreshTokenTTL = time.Hour * 24 * 7
+
+func GenerateAllTokens(userId, firstName, lastName, email, role, familyId string, twoFactor bool) (string, string, error) {
 	claims := &SigninDetails{
 		Email:     email,
 		FirstName: firstName,
 		LastName:  lastName,
 		Role:      role,
 		UserId:    userId,
+		FamilyId:  familyId,
+		TwoFactor: twoFactor,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        bson.NewObjectID().Hex(),
 			Issuer:    "movie-app-go",
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString([]byte(JWT_SECRET_KEY))
+	signedToken, err := signAccessToken(claims)
 	if err != nil {
 		return "", "", err
 	}
@@ -52,15 +63,18 @@ func GenerateAllTokens(userId, firstName, lastName, email, role string) (string,
 		LastName:  lastName,
 		Role:      role,
 		UserId:    userId,
+		FamilyId:  familyId,
+		TwoFactor: twoFactor,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        bson.NewObjectID().Hex(),
 			Issuer:    "movie-app-go",
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour * 24 * 7)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(RefreshTokenTTL)),
 		},
 	}
 
 	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	signedRefreshToken, err := refreshToken.SignedString([]byte(JWT_REFRESH_SECRET_KEY))
+	signedRefreshToken, err := refreshToken.SignedString(refreshSecret())
 	if err != nil {
 		return "", "", err
 	}
@@ -68,50 +82,52 @@ func GenerateAllTokens(userId, firstName, lastName, email, role string) (string,
 	return signedToken, signedRefreshToken, nil
 }
 
-func UpdateAllTokens(userId, token, refreshToken string, client *mongo.Client) (err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	updateAt, _ := time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
-
-	data := bson.M{
-		"$set": bson.M{
-			"token":         token,
-			"refresh_token": refreshToken,
-			"updated_at":    updateAt,
-		},
-	}
-
-	var userCollection *mongo.Collection = database.OpenCollection(client, "users")
-	_, err = userCollection.UpdateOne(
-		ctx,
-		bson.M{"user_id": userId},
-		data,
-	)
-
+// signAccessToken signs with the active key and names it in the kid header.
+func signAccessToken(claims *SigninDetails) (string, error) {
+	signingKey, err := Keys.Active()
 	if err != nil {
-		return err
+		return "", err
 	}
-	return nil
+
+	token := jwt.NewWithClaims(signingKey.Method, claims)
+	token.Header["kid"] = signingKey.Kid
+	return token.SignedString(signingKey.Private)
 }
 
 func ValidateToken(tokenStr string) (*SigninDetails, error) {
 	claims := &SigninDetails{}
 
-	token, err := jwt.ParseWithClaims(
+	_, err := jwt.ParseWithClaims(
 		tokenStr,
 		claims,
 		func(token *jwt.Token) (interface{}, error) {
-			return []byte(JWT_SECRET_KEY), nil
+			if typ, _ := token.Header["typ"].(string); typ == PurposeTokenType {
+				return nil, errors.New("not an access token")
+			}
+
+			kid, _ := token.Header["kid"].(string)
+
+			key, ok := Keys.Lookup(kid)
+			if !ok {
+				return nil, errors.New("unknown signing key")
+			}
+
+			if token.Method.Alg() != key.Method.Alg() {
+				return nil, errors.New("unexpected signing method")
+			}
+
+			return key.Public, nil
 		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
 	)
 
 	if err != nil {
 		return nil, err
 	}
 
-	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-		return nil, err
+	// Purpose tokens also carry an audience, access tokens don't
+	if len(claims.Audience) > 0 {
+		return nil, errors.New("not an access token")
 	}
 
 	if claims.ExpiresAt.Time.Before(time.Now()) {
@@ -128,7 +144,7 @@ func ValidateRefreshToken(tokenStr string) (*SigninDetails, error) {
 		tokenStr,
 		claims,
 		func(token *jwt.Token) (interface{}, error) {
-			return []byte(JWT_REFRESH_SECRET_KEY), nil
+			return refreshSecret(), nil
 		},
 	)
 
@@ -148,21 +164,29 @@ func ValidateRefreshToken(tokenStr string) (*SigninDetails, error) {
 }
 
 func GetAcessToken(c *gin.Context) (string, error) {
+	token, _, err := GetAccessTokenWithSource(c)
+	return token, err
+}
+
+// GetAccessTokenWithSource also reports whether the token came from the
+// access_token cookie, which browsers attach on their own and therefore
+// needs CSRF protection.
+func GetAccessTokenWithSource(c *gin.Context) (string, bool, error) {
 	if cookieToken, err := c.Cookie("access_token"); err == nil && cookieToken != "" {
-		return cookieToken, nil
+		return cookieToken, true, nil
 	}
 
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
-		return "", errors.New("missing access token")
+		return "", false, errors.New("missing access token")
 	}
 
 	const bearerPrefix = "Bearer "
 	if len(authHeader) > len(bearerPrefix) && authHeader[:len(bearerPrefix)] == bearerPrefix {
-		return authHeader[len(bearerPrefix):], nil
+		return authHeader[len(bearerPrefix):], false, nil
 	}
 
-	return authHeader, nil
+	return authHeader, false, nil
 }
 
 func GetuserIdFromCtx(c *gin.Context) (string, error) {
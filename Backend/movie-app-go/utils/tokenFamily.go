@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const maxUserAgentLength = 512
+
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+var ErrTokenFamilyRevoked = errors.New("token family revoked")
+
+func NewTokenFamilyID() string {
+	return bson.NewObjectID().Hex()
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession records a new login as its own token family, so every device
+// keeps its own refresh token. Only the hash of the refresh token is stored.
+func CreateSession(userId, familyId, refreshToken, userAgent, ip string, client *mongo.Client) error {
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+
+	var familyCollection *mongo.Collection = database.OpenCollection(client, "token_families")
+	_, err := familyCollection.InsertOne(ctx, models.TokenFamily{
+		FamilyID:        familyId,
+		UserID:          userId,
+		TokenHash:       HashToken(refreshToken),
+		UserAgent:       userAgent,
+		IP:              ip,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		LastRefreshedAt: now,
+		ExpiresAt:       now.Add(RefreshTokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	// Tokens used to live on the user document; drop any legacy copies
+	var userCollection *mongo.Collection = database.OpenCollection(client, "users")
+	_, err = userCollection.UpdateOne(
+		ctx,
+		bson.M{"user_id": userId, "$or": bson.A{
+			bson.M{"token": bson.M{"$exists": true}},
+			bson.M{"access_token": bson.M{"$exists": true}},
+			bson.M{"refresh_token": bson.M{"$exists": true}},
+		}},
+		bson.M{"$unset": bson.M{"token": "", "access_token": "", "refresh_token": ""}},
+	)
+	return err
+}
+
+// RotateRefreshToken swaps the current refresh token of a family for a new
+// one. If the presented token is not the current one the session is revoked
+// and ErrRefreshTokenReused is returned.
+func RotateRefreshToken(familyId, presentedToken, newToken, ip string, client *mongo.Client) error {
+	if familyId == "" {
+		return ErrTokenFamilyRevoked
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+
+	var familyCollection *mongo.Collection = database.OpenCollection(client, "token_families")
+	result, err := familyCollection.UpdateOne(
+		ctx,
+		bson.M{"family_id": familyId, "token_hash": HashToken(presentedToken), "revoked": false},
+		bson.M{"$set": bson.M{
+			"token_hash":        HashToken(newToken),
+			"ip":                ip,
+			"updated_at":        now,
+			"last_refreshed_at": now,
+			"expires_at":        now.Add(RefreshTokenTTL),
+		}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 1 {
+		return nil
+	}
+
+	var family models.TokenFamily
+	err = familyCollection.FindOne(ctx, bson.M{"family_id": familyId}).Decode(&family)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrTokenFamilyRevoked
+		}
+		return err
+	}
+
+	if family.Revoked {
+		return ErrTokenFamilyRevoked
+	}
+
+	// The signature was valid but the token is not the current one: it has
+	// already been rotated, so somebody is replaying it.
+	if err := RevokeSession(ctx, familyId, client); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+func RevokeTokenFamily(familyId string, client *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var familyCollection *mongo.Collection = database.OpenCollection(client, "token_families")
+	_, err := familyCollection.UpdateOne(
+		ctx,
+		bson.M{"family_id": familyId},
+		bson.M{"$set": bson.M{"revoked": true, "updated_at": time.Now()}},
+	)
+	return err
+}
+
+// RevokeSession ends one login: its refresh token family can't be rotated any
+// more and the access tokens issued to it are refused.
+func RevokeSession(ctx context.Context, familyId string, client *mongo.Client) error {
+	if err := RevokeTokenFamily(familyId, client); err != nil {
+		return err
+	}
+	return Revocations.RevokeFamilyTokens(ctx, familyId)
+}
+
+// ListUserSessions returns the sessions of a user that can still be
+// refreshed, most recently used first.
+func ListUserSessions(ctx context.Context, userId string, client *mongo.Client) ([]models.TokenFamily, error) {
+	var familyCollection *mongo.Collection = database.OpenCollection(client, "token_families")
+
+	cursor, err := familyCollection.Find(
+		ctx,
+		bson.M{"user_id": userId, "revoked": false, "expires_at": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.D{{Key: "last_refreshed_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []models.TokenFamily{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// RevokeUserSession revokes one session of a user. It reports false when the
+// user has no such active session.
+func RevokeUserSession(ctx context.Context, userId, familyId string, client *mongo.Client) (bool, error) {
+	var familyCollection *mongo.Collection = database.OpenCollection(client, "token_families")
+
+	count, err := familyCollection.CountDocuments(ctx, bson.M{"family_id": familyId, "user_id": userId, "revoked": false})
+	if err != nil || count == 0 {
+		return false, err
+	}
+
+	return true, RevokeSession(ctx, familyId, client)
+}
+
+// RevokeOtherSessions revokes every session of a user except keepFamilyId
+// and returns how many were revoked. An empty keepFamilyId revokes them all.
+func RevokeOtherSessions(ctx context.Context, userId, keepFamilyId string, client *mongo.Client) (int, error) {
+	sessions, err := ListUserSessions(ctx, userId, client)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, session := range sessions {
+		if session.FamilyID == keepFamilyId {
+			continue
+		}
+		if err := RevokeSession(ctx, session.FamilyID, client); err != nil {
+			return revoked, err
+		}
+		revoked++
+	}
+	return revoked, nil
+}
+
+func RevokeUserTokenFamilies(userId string, client *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var familyCollection *mongo.Collection = database.OpenCollection(client, "token_families")
+	_, err := familyCollection.UpdateMany(
+		ctx,
+		bson.M{"user_id": userId, "revoked": false},
+		bson.M{"$set": bson.M{"revoked": true, "updated_at": time.Now()}},
+	)
+	return err
+}
+
+// EnsureTokenFamilyIndexes makes family ids unique and lets Mongo drop
+// families once their last refresh token has expired.
+func EnsureTokenFamilyIndexes(client *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var familyCollection *mongo.Collection = database.OpenCollection(client, "token_families")
+	_, err := familyCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "family_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	return err
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestRotateRefreshToken(t *testing.T) {
+	client := testMongoClient(t)
+	useTestSigningKey(t)
+	useTestRefreshSecret(t)
+
+	previousRevocations := Revocations
+	Revocations = NewMemoryRevocationStore()
+	t.Cleanup(func() { Revocations = previousRevocations })
+
+	familyId := NewTokenFamilyID()
+	issue := func() (string, string) {
+		t.Helper()
+		accessToken, refreshToken, err := GenerateAllTokens("user-1", "Test", "User", "user@example.com", "USER", familyId, false)
+		if err != nil {
+			t.Fatalf("GenerateAllTokens: %v", err)
+		}
+		return accessToken, refreshToken
+	}
+
+	_, first := issue()
+	if err := CreateSession("user-1", familyId, first, "test", "127.0.0.1", client); err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	_, second := issue()
+	if err := RotateRefreshToken(familyId, first, second, "127.0.0.2", client); err != nil {
+		t.Fatalf("rotating the current token: %v", err)
+	}
+	accessToken, third := issue()
+	if err := RotateRefreshToken(familyId, second, third, "127.0.0.2", client); err != nil {
+		t.Fatalf("rotating the next token: %v", err)
+	}
+
+	var family models.TokenFamily
+	familyCollection := database.OpenCollection(client, "token_families")
+	if err := familyCollection.FindOne(context.Background(), bson.M{"family_id": familyId}).Decode(&family); err != nil {
+		t.Fatalf("loading session: %v", err)
+	}
+	if family.TokenHash != HashToken(third) || family.IP != "127.0.0.2" || family.Revoked {
+		t.Fatalf("session after rotation = %+v, want the third token's hash, the new IP and not revoked", family)
+	}
+
+	// Replaying a rotated token means it was stolen: the whole session ends
+	_, fourth := issue()
+	if err := RotateRefreshToken(familyId, first, fourth, "198.51.100.1", client); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replaying a rotated token = %v, want ErrRefreshTokenReused", err)
+	}
+
+	if err := familyCollection.FindOne(context.Background(), bson.M{"family_id": familyId}).Decode(&family); err != nil {
+		t.Fatalf("loading session: %v", err)
+	}
+	if !family.Revoked {
+		t.Fatal("session not revoked after a replayed refresh token")
+	}
+
+	if err := RotateRefreshToken(familyId, third, fourth, "127.0.0.2", client); !errors.Is(err, ErrTokenFamilyRevoked) {
+		t.Fatalf("rotating the current token of a revoked session = %v, want ErrTokenFamilyRevoked", err)
+	}
+
+	claims, err := ValidateToken(accessToken)
+	if err != nil {
+		t.Fatalf("ValidateToken: %v", err)
+	}
+	if revoked, err := Revocations.IsRevoked(context.Background(), claims); err != nil || !revoked {
+		t.Fatalf("access token of the revoked session: revoked=%v err=%v, want revoked", revoked, err)
+	}
+
+	if err := RotateRefreshToken("", third, fourth, "127.0.0.2", client); !errors.Is(err, ErrTokenFamilyRevoked) {
+		t.Fatalf("rotating without a family = %v, want ErrTokenFamilyRevoked", err)
+	}
+	if err := RotateRefreshToken(NewTokenFamilyID(), third, fourth, "127.0.0.2", client); !errors.Is(err, ErrTokenFamilyRevoked) {
+		t.Fatalf("rotating an unknown family = %v, want ErrTokenFamilyRevoked", err)
+	}
+}
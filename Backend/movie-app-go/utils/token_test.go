@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"testing"
+
+	"movie-app-go/secrets"
+)
+
+// useTestRefreshSecret signs refresh and CSRF tokens with a test secret.
+func useTestRefreshSecret(t *testing.T) {
+	t.Helper()
+
+	t.Setenv(JWT_REFRESH_SECRET_KEY, "t3st-R3fr3sh-k3y-9f2Lq8Zr1Tx7Vb4Nm6Wc")
+	if err := secrets.Default.Load(); err != nil {
+		t.Fatalf("loading secrets: %v", err)
+	}
+}
+
+func TestGenerateAllTokensAreDistinctWithinASecond(t *testing.T) {
+	useTestSigningKey(t)
+	useTestRefreshSecret(t)
+
+	familyId := NewTokenFamilyID()
+	seen := map[string]bool{}
+	jtis := map[string]bool{}
+
+	// Same user, same session, same second: only the jti tells tokens apart
+	for i := 0; i < 5; i++ {
+		accessToken, refreshToken, err := GenerateAllTokens("user-1", "Test", "User", "user@example.com", "USER", familyId, false)
+		if err != nil {
+			t.Fatalf("GenerateAllTokens: %v", err)
+		}
+
+		for _, token := range []string{accessToken, refreshToken} {
+			if seen[token] {
+				t.Fatalf("GenerateAllTokens returned the same token twice: %s", token)
+			}
+			seen[token] = true
+		}
+
+		access, err := ValidateToken(accessToken)
+		if err != nil {
+			t.Fatalf("ValidateToken: %v", err)
+		}
+		refresh, err := ValidateRefreshToken(refreshToken)
+		if err != nil {
+			t.Fatalf("ValidateRefreshToken: %v", err)
+		}
+		for _, jti := range []string{access.ID, refresh.ID} {
+			if jti == "" || jtis[jti] {
+				t.Fatalf("jti %q is empty or reused", jti)
+			}
+			jtis[jti] = true
+		}
+		if access.FamilyId != familyId || refresh.FamilyId != familyId {
+			t.Fatalf("family ids = %q and %q, want %q", access.FamilyId, refresh.FamilyId, familyId)
+		}
+	}
+}
+
+func TestAccessAndRefreshTokensAreNotInterchangeable(t *testing.T) {
+	useTestSigningKey(t)
+	useTestRefreshSecret(t)
+
+	accessToken, refreshToken, err := GenerateAllTokens("user-1", "Test", "User", "user@example.com", "USER", NewTokenFamilyID(), false)
+	if err != nil {
+		t.Fatalf("GenerateAllTokens: %v", err)
+	}
+
+	if _, err := ValidateToken(refreshToken); err == nil {
+		t.Error("a refresh token passed as an access token")
+	}
+	if _, err := ValidateRefreshToken(accessToken); err == nil {
+		t.Error("an access token passed as a refresh token")
+	}
+}
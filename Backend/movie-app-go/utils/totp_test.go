@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// RFC 6238 Appendix B, SHA-1 with the ASCII key "12345678901234567890". The
+// RFC lists 8 digit codes; ours are the last 6 of them.
+func TestTOTPCodeRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+// currentTOTPStep returns the current step, waiting for the next one when
+// the current is about to end so a test doesn't straddle two steps.
+func currentTOTPStep() int64 {
+	if time.Now().Unix()%totpPeriod >= totpPeriod-2 {
+		time.Sleep(3 * time.Second)
+	}
+	return time.Now().Unix() / totpPeriod
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatalf("NewTOTPSecret: %v", err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatalf("decoding secret: %v", err)
+	}
+
+	current := currentTOTPStep()
+
+	tests := []struct {
+		name     string
+		step     int64
+		lastStep int64
+		wantOK   bool
+	}{
+		{name: "current step", step: current, wantOK: true},
+		{name: "one step behind", step: current - 1, wantOK: true},
+		{name: "one step ahead", step: current + 1, wantOK: true},
+		{name: "two steps behind", step: current - 2},
+		{name: "two steps ahead", step: current + 2},
+		{name: "step already used", step: current, lastStep: current},
+		{name: "step before the last used one", step: current - 1, lastStep: current},
+		{name: "step after the last used one", step: current + 1, lastStep: current, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := VerifyTOTP(secret, totpCode(key, tt.step), tt.lastStep)
+			if ok != tt.wantOK {
+				t.Fatalf("VerifyTOTP ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && step != tt.step {
+				t.Fatalf("VerifyTOTP step = %d, want %d", step, tt.step)
+			}
+		})
+	}
+}
+
+func TestVerifyTOTPRejectsMalformedInput(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatalf("NewTOTPSecret: %v", err)
+	}
+	key, _ := totpEncoding.DecodeString(secret)
+	code := totpCode(key, currentTOTPStep())
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+	}{
+		{name: "secret that isn't base32", secret: "not base32!", code: code},
+		{name: "short code", secret: secret, code: code[:5]},
+		{name: "long code", secret: secret, code: code + "0"},
+		{name: "empty code", secret: secret, code: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := VerifyTOTP(tt.secret, tt.code, 0); ok {
+				t.Fatal("VerifyTOTP accepted malformed input")
+			}
+		})
+	}
+
+	// Pasted codes often come with surrounding whitespace
+	if _, ok := VerifyTOTP(secret, " "+code+" ", 0); !ok {
+		t.Fatal("VerifyTOTP refused a code surrounded by spaces")
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{code: "abcde-fghij", want: "abcde-fghij"},
+		{code: "abcdefghij", want: "abcde-fghij"},
+		{code: "ABCDE-FGHIJ", want: "abcde-fghij"},
+		{code: "  abcde-fghij\n", want: "abcde-fghij"},
+		{code: "ab-cde-fg-hij", want: "abcde-fghij"},
+		{code: "abc", want: "abc"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeRecoveryCode(tt.code); got != tt.want {
+			t.Errorf("NormalizeRecoveryCode(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+
+	codes, err := NewRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("NewRecoveryCodes: %v", err)
+	}
+	for _, code := range codes {
+		if NormalizeRecoveryCode(code) != code {
+			t.Errorf("generated code %q isn't in normal form", code)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"movie-app-go/database"
+	"movie-app-go/models"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	ErrCodeAccountSuspended = "account_suspended"
+	ErrCodeAccountBanned    = "account_banned"
+)
+
+// AccountStatusError explains why a suspended or banned account was turned
+// away. Code tells clients the two cases apart.
+type AccountStatusError struct {
+	Status string
+	Code   string
+	Reason string
+	Until  *time.Time
+}
+
+func (e *AccountStatusError) Error() string {
+	if e.Status == models.UserStatusBanned {
+		return "Account is banned"
+	}
+	return "Account is suspended"
+}
+
+// Response is the body sent with the 403 refusing the account.
+func (e *AccountStatusError) Response() gin.H {
+	response := gin.H{"error": e.Error(), "code": e.Code}
+	if e.Reason != "" {
+		response["reason"] = e.Reason
+	}
+	if e.Until != nil {
+		response["until"] = e.Until
+	}
+	return response
+}
+
+// CheckAccountStatus returns nil when an account with this status may sign
+// in, either because it is active or because its suspension or ban expired.
+func CheckAccountStatus(status, reason string, until *time.Time) *AccountStatusError {
+	if status == "" || status == models.UserStatusActive {
+		return nil
+	}
+	if until != nil && !until.After(time.Now()) {
+		return nil
+	}
+
+	code := ErrCodeAccountSuspended
+	if status == models.UserStatusBanned {
+		code = ErrCodeAccountBanned
+	}
+	return &AccountStatusError{Status: status, Code: code, Reason: reason, Until: until}
+}
+
+// AccountStatusLookup is how AuthenticationMiddleware checks the account
+// behind every access token. Tests swap it out to run without a database.
+var AccountStatusLookup = LookupAccountStatus
+
+// LookupAccountStatus reads the status of a user and checks it like
+// CheckAccountStatus. Unknown users count as active.
+func LookupAccountStatus(ctx context.Context, client *mongo.Client, userId string) (*AccountStatusError, error) {
+	var userCollection *mongo.Collection = database.OpenCollection(client, "users")
+
+	var user models.User
+	err := userCollection.FindOne(
+		ctx,
+		bson.M{"user_id": userId},
+		options.FindOne().SetProjection(bson.M{"status": 1, "status_reason": 1, "status_until": 1}),
+	).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return CheckAccountStatus(user.Status, user.StatusReason, user.StatusUntil), nil
+}
@@ -12,7 +12,7 @@ const Register = () => {
     const [email, setEmail] = useState('');
     const [password, setPassword] = useState('');
     const [confirmPassword, setConfirmPassword] = useState('');
-    const [FavouriteMoviesGenres, setFavouriteGenres] = useState([]);
+    const [favouriteGenreIds, setFavouriteGenreIds] = useState([]);
     const [genres, setGenres] = useState([]);
 
     const [error, setError] = useState(null);
@@ -21,10 +21,7 @@ const Register = () => {
 
     const handleGenreChange = (e) => {
         const options = Array.from(e.target.selectedOptions);
-        setFavouriteGenres(options.map(opt => ({
-            genre_id: String(opt.value),
-            genre_name: opt.label
-        })));
+        setFavouriteGenreIds(options.map(opt => String(opt.value)));
     };
     const handleSubmit = async (e) => {
         e.preventDefault();
@@ -47,7 +44,7 @@ const Register = () => {
                 email,
                 password,
                 role: defaultRole,
-                favourite_movies_genres: FavouriteMoviesGenres
+                favourite_genre_ids: favouriteGenreIds
             };
             const response = await axiosClient.post('/register', payload);
             if (response.data.error) {
@@ -67,6 +64,8 @@ const Register = () => {
     useEffect(() => {
         const fetchGenres = async () => {
             try {
+                // Visitors browse the genres with an anonymous guest token
+                await axiosClient.post('/guest');
                 const response = await axiosClient.get('/genres');
                 const payload = response.data?.data || [];
                 setGenres(payload);
@@ -149,7 +148,7 @@ const Register = () => {
                     <Form.Group>
                         <Form.Select
                             multiple
-                            value={FavouriteMoviesGenres.map(g => String(g.genre_id))}
+                            value={favouriteGenreIds}
                             onChange={handleGenreChange}
                         >
                             {genres.map(genre => (
@@ -33,7 +33,25 @@ const useAxios = () => {
 
     useEffect(() => {
 
-        axiosAuth.interceptors.response.use(
+        // Cookie-authenticated writes must echo the CSRF token issued at login
+        const csrfInterceptor = axiosAuth.interceptors.request.use(async config => {
+            const method = (config.method || 'get').toLowerCase();
+            if (!['post', 'put', 'patch', 'delete'].includes(method)) {
+                return config;
+            }
+
+            let csrfToken = auth?.csrf_token;
+            if (!csrfToken) {
+                const response = await axiosAuth.get('/csrf-token');
+                csrfToken = response.data.csrf_token;
+                setAuth(prev => prev ? { ...prev, csrf_token: csrfToken } : prev);
+            }
+
+            config.headers['X-CSRF-Token'] = csrfToken;
+            return config;
+        });
+
+        const refreshInterceptor = axiosAuth.interceptors.response.use(
             response => response,
             async error => {
                 console.log('Interceptor caught error:', error);
@@ -88,6 +106,12 @@ const useAxios = () => {
             }
         );
 
+        // Drop this render's interceptors so they don't pile up on every auth change
+        return () => {
+            axiosAuth.interceptors.request.eject(csrfInterceptor);
+            axiosAuth.interceptors.response.eject(refreshInterceptor);
+        };
+
     }, [auth]);
 
     return axiosAuth;